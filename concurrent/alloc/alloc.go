@@ -0,0 +1,159 @@
+// Package alloc provides byte-buffer allocators behind the Allocator
+// interface benchmarked in concurrent/basic/memorypool_test.go: Heap, which
+// just calls make; Slab, which reuses buffers of power-of-two size classes
+// through per-class sync.Pools; and Arena, which carves buffers out of one
+// fixed-capacity block. Slab and Arena keep usage Stats and detect a buffer
+// freed twice or a buffer they did not allocate.
+// alloc 包提供了实现 Allocator 接口（在 concurrent/basic/memorypool_test.go 中进行基准测试）
+// 的字节缓存分配器：Heap 只是调用 make；Slab 通过每个大小等级各自的 sync.Pool 重用大小为
+// 2 的幂的缓存；Arena 从一整块固定容量的内存中切分出缓存。Slab 与 Arena 记录使用情况的统计
+// （Stats），并能检测出被释放两次的缓存以及不是由它们分配的缓存。
+package alloc
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+	"weak"
+)
+
+// Allocator allocates byte buffers that are handed back with Free once
+// they are no longer used.
+// Allocator 分配字节缓存，缓存不再使用时要用 Free 交还。
+type Allocator interface {
+	// Alloc returns a zeroed buffer of length n.
+	// Alloc 返回一个长度为 n 的、内容为零的缓存。
+	Alloc(n int) []byte
+	// Free hands b back to the allocator; b must not be used afterwards.
+	// Free 把 b 交还给分配器，之后不能再使用 b。
+	Free(b []byte)
+}
+
+// Errors returned by TryFree. Free ignores the buffer instead, and the
+// Stats count the misuse.
+// TryFree 返回的错误。Free 则会忽略这样的缓存，并在 Stats 中记录这次误用。
+var (
+	ErrDoubleFree  = errors.New("alloc: buffer freed twice")
+	ErrForeignFree = errors.New("alloc: buffer not allocated by this allocator")
+)
+
+// Heap allocates every buffer with make and leaves freeing to the GC.
+// Heap 用 make 分配每个缓存，把释放交给垃圾回收器。
+type Heap struct{}
+
+func (Heap) Alloc(n int) []byte { return make([]byte, n) }
+
+func (Heap) Free([]byte) {}
+
+// Stats reports the usage of an allocator.
+// Stats 报告分配器的使用情况。
+type Stats struct {
+	Allocs uint64 // successful Alloc calls 成功的 Alloc 调用次数
+	Frees  uint64 // successful Free calls 成功的 Free 调用次数
+	// Fresh counts the buffers made on the Go heap rather than reused.
+	// Fresh 统计在 Go 堆上新建、而非重用的缓存数量。
+	Fresh        uint64
+	InUse        int64 // buffers allocated and not yet freed 已分配尚未释放的缓存数
+	InUseBytes   int64 // capacity of the buffers in use 正在使用的缓存的总容量
+	DoubleFrees  uint64
+	ForeignFrees uint64
+}
+
+// counters holds the Stats of an allocator as atomics.
+type counters struct {
+	allocs, frees, fresh, doubleFrees, foreignFrees atomic.Uint64
+	inUse, inUseBytes                               atomic.Int64
+}
+
+func (c *counters) stats() Stats {
+	return Stats{
+		Allocs:       c.allocs.Load(),
+		Frees:        c.frees.Load(),
+		Fresh:        c.fresh.Load(),
+		InUse:        c.inUse.Load(),
+		InUseBytes:   c.inUseBytes.Load(),
+		DoubleFrees:  c.doubleFrees.Load(),
+		ForeignFrees: c.foreignFrees.Load(),
+	}
+}
+
+func (c *counters) alloc(capacity int) {
+	c.allocs.Add(1)
+	c.inUse.Add(1)
+	c.inUseBytes.Add(int64(capacity))
+}
+
+// free counts the outcome of a Free of a buffer of the given capacity.
+func (c *counters) free(capacity int, err error) {
+	switch err {
+	case nil:
+		c.frees.Add(1)
+		c.inUse.Add(-1)
+		c.inUseBytes.Add(-int64(capacity))
+	case ErrDoubleFree:
+		c.doubleFrees.Add(1)
+	case ErrForeignFree:
+		c.foreignFrees.Add(1)
+	}
+}
+
+// A tracker remembers, for every buffer an allocator has handed out,
+// whether it is in use. Buffers are keyed by weak pointers to their first
+// byte, so that the tracker does not keep buffers dropped by a sync.Pool
+// alive; a cleanup forgets a buffer once the GC has collected it. The
+// cleanups reference the tracker, so allocators hold it by pointer and it
+// must not reference the buffers. Each buffer has its own atomic state in a
+// sync.Map, so Alloc and Free of different buffers do not contend.
+// tracker 记住分配器交出的每个缓存是否正在使用。缓存以指向其第一个字节的弱指针为键，
+// 这样 tracker 不会让被 sync.Pool 丢弃的缓存一直存活；缓存被垃圾回收之后，清理函数会忘掉它。
+// 清理函数引用了 tracker，因此分配器通过指针持有它，而它不能引用这些缓存。每个缓存在
+// sync.Map 中都有自己的原子状态，因此不同缓存的 Alloc 与 Free 不会相互争用。
+type tracker struct {
+	slots sync.Map // weak.Pointer[byte] -> *trackedSlot
+}
+
+type slot struct {
+	cap   int
+	inUse bool
+}
+
+// trackedSlot is the slot of a tracked buffer, updated without locks.
+type trackedSlot struct {
+	cap   int
+	inUse atomic.Bool
+}
+
+// alloc records that b, a full-capacity buffer, is in use.
+func (t *tracker) alloc(b []byte) {
+	p := unsafe.SliceData(b)
+	key := weak.Make(p)
+	v, known := t.slots.Load(key)
+	if known && v.(*trackedSlot).cap == cap(b) {
+		v.(*trackedSlot).inUse.Store(true)
+		return
+	}
+	s := &trackedSlot{cap: cap(b)}
+	s.inUse.Store(true)
+	t.slots.Store(key, s)
+	if !known {
+		runtime.AddCleanup(p, t.forget, key)
+	}
+}
+
+// free records that b is no longer in use, or reports why it cannot be freed.
+func (t *tracker) free(b []byte) error {
+	v, ok := t.slots.Load(weak.Make(unsafe.SliceData(b)))
+	switch {
+	case !ok || v.(*trackedSlot).cap != cap(b):
+		return ErrForeignFree
+	case !v.(*trackedSlot).inUse.CompareAndSwap(true, false): //!!! 两个并发的 Free 只有一个能成功
+		return ErrDoubleFree
+	}
+	return nil
+}
+
+func (t *tracker) forget(key weak.Pointer[byte]) {
+	t.slots.Delete(key)
+}
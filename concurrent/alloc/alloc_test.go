@@ -0,0 +1,144 @@
+package alloc
+
+import (
+	"sync"
+	"testing"
+)
+
+// tryFreer 是 Slab 与 Arena 共同的方法集。
+type tryFreer interface {
+	Allocator
+	TryFree(b []byte) error
+	Stats() Stats
+}
+
+func forEachAllocator(t *testing.T, f func(t *testing.T, a tryFreer)) {
+	for name, newAlloc := range map[string]func() tryFreer{
+		"slab":  func() tryFreer { return NewSlab() },
+		"arena": func() tryFreer { return NewArena(1 << 10) },
+	} {
+		t.Run(name, func(t *testing.T) { f(t, newAlloc()) })
+	}
+}
+
+func TestAllocZeroedAndStats(t *testing.T) {
+	forEachAllocator(t, func(t *testing.T, a tryFreer) {
+		b := a.Alloc(10)
+		if len(b) != 10 {
+			t.Fatalf("len = %d", len(b))
+		}
+		for i := range b {
+			b[i] = 0xff
+		}
+		a.Free(b)
+		//同一个缓存可能被重用，内容必须重新清零。
+		b = a.Alloc(10)
+		for _, c := range b {
+			if c != 0 {
+				t.Fatalf("Alloc returned dirty memory %v", b)
+			}
+		}
+		if len(a.Alloc(0)) != 0 {
+			t.Error("Alloc(0) is not empty")
+		}
+		s := a.Stats()
+		if s.Allocs != 2 || s.Frees != 1 || s.InUse != 1 || s.InUseBytes != int64(cap(b)) {
+			t.Errorf("stats %+v", s)
+		}
+	})
+}
+
+func TestFreeMisuse(t *testing.T) {
+	forEachAllocator(t, func(t *testing.T, a tryFreer) {
+		b := a.Alloc(10)
+		if err := a.TryFree(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.TryFree(b); err != ErrDoubleFree {
+			t.Errorf("second free: %v, want ErrDoubleFree", err)
+		}
+		if err := a.TryFree(make([]byte, 16)); err != ErrForeignFree {
+			t.Errorf("free of a heap buffer: %v, want ErrForeignFree", err)
+		}
+		b = a.Alloc(10)
+		if err := a.TryFree(b[1:]); err != ErrForeignFree {
+			t.Errorf("free of a sub-slice: %v, want ErrForeignFree", err)
+		}
+		a.Free(b)
+		a.Free(b)
+		s := a.Stats()
+		if s.DoubleFrees != 2 || s.ForeignFrees != 2 || s.InUse != 0 || s.Frees != 2 {
+			t.Errorf("stats %+v", s)
+		}
+	})
+}
+
+func TestAllocConcurrent(t *testing.T) {
+	forEachAllocator(t, func(t *testing.T, a tryFreer) {
+		var wg sync.WaitGroup
+		for g := range 8 {
+			wg.Go(func() {
+				for i := range 1000 {
+					b := a.Alloc(1 + (g*i)%100)
+					b[0] = byte(g)
+					if err := a.TryFree(b); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+		if s := a.Stats(); s.Allocs != 8000 || s.Frees != 8000 || s.InUse != 0 || s.InUseBytes != 0 {
+			t.Errorf("stats %+v", s)
+		}
+	})
+}
+
+func TestSlabClasses(t *testing.T) {
+	s := NewSlab()
+	for n, want := range map[int]int{1: 16, 16: 16, 17: 32, 1000: 1024, 1 << 16: 1 << 16, 1<<16 + 1: 1<<16 + 1} {
+		if b := s.Alloc(n); len(b) != n || cap(b) != want {
+			t.Errorf("Alloc(%d): len %d cap %d, want cap %d", n, len(b), cap(b), want)
+		}
+	}
+}
+
+func TestArenaRestartsAndOverflows(t *testing.T) {
+	a := NewArena(100)
+	b1, b2 := a.Alloc(60), a.Alloc(60)
+	_, in1 := a.offset(b1)
+	_, in2 := a.offset(b2)
+	if !in1 || in2 || a.Stats().Fresh != 1 {
+		t.Fatalf("60+60 bytes in a 100-byte arena: fresh %d", a.Stats().Fresh)
+	}
+	b1 = append(b1, 1)
+	a.Free(b1) //append 之后 b1 已经搬到堆上，不再属于 a。
+	if a.Stats().ForeignFrees != 1 {
+		t.Errorf("append moved the buffer, stats %+v", a.Stats())
+	}
+
+	a = NewArena(100)
+	b1, b2 = a.Alloc(30), a.Alloc(30)
+	a.Free(b1)
+	if b3 := a.Alloc(10); &b3[0] != &a.block[60] {
+		t.Error("arena restarted while buffers were live")
+	}
+	a.Free(b2)
+	a.Free(a.block[60:70:70])
+	//所有缓存都已释放，下一次分配从块的开头重新开始。
+	if b := a.Alloc(10); &b[0] != &a.block[0] {
+		t.Error("arena did not restart once every buffer was freed")
+	}
+}
+
+// BenchmarkSlabParallel 从多个 goroutine 同时分配与释放同一个大小等级的缓存：
+// 跟踪状态不能让它们在一把全局锁上串行。
+func BenchmarkSlabParallel(b *testing.B) {
+	s := NewSlab()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Free(s.Alloc(64))
+		}
+	})
+}
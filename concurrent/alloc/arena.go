@@ -0,0 +1,120 @@
+package alloc
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// An Arena carves buffers one after another out of a single block of fixed
+// capacity. Memory is not reused buffer by buffer: once every buffer of the
+// block has been freed, the next allocation starts over at its beginning.
+// When the block is full, buffers are made on the heap instead. It suits
+// batches of short-lived buffers that are freed together, as in allocloop.
+// An Arena is safe for concurrent use.
+// Arena 从一整块固定容量的内存中依次切分出缓存。内存不是逐个缓存地重用的：当这块内存中
+// 的所有缓存都被释放之后，下一次分配会从它的开头重新开始。这块内存用完时，缓存改为在堆上
+// 新建。它适合一批一起释放的短期缓存，例如 allocloop 中的那样。Arena 可以被并发使用。
+type Arena struct {
+	mu    sync.Mutex
+	block []byte
+	off   int // start of the next buffer in block 下一个缓存在 block 中的开始位置
+	live  int // buffers in block not yet freed block 中尚未释放的缓存数
+	// slots tracks the buffers of block by offset: they live as long as a
+	// does, so they need no weak pointers. track covers the heap buffers.
+	//slots 按偏移量跟踪 block 中的缓存：它们与 a 的生命期相同，不需要弱指针。
+	//track 跟踪在堆上新建的缓存。
+	slots map[int]slot
+	track *tracker
+	stats counters
+}
+
+// NewArena returns an Arena whose block holds capacity bytes.
+// NewArena 返回一个内存块容量为 capacity 字节的 Arena。
+func NewArena(capacity int) *Arena {
+	return &Arena{block: make([]byte, capacity), slots: make(map[int]slot), track: new(tracker)}
+}
+
+// Alloc returns a zeroed buffer of length and capacity n. Alloc(0) returns
+// an empty buffer, which Free ignores.
+// Alloc 返回一个长度与容量都为 n 的、内容为零的缓存。Alloc(0) 返回一个空的缓存，Free 会忽略它。
+func (a *Arena) Alloc(n int) []byte {
+	if n < 0 {
+		panic("alloc: negative size")
+	}
+	if n == 0 {
+		return []byte{}
+	}
+	var b []byte
+	a.mu.Lock()
+	if n <= len(a.block)-a.off {
+		//!!! 用三下标切片把容量限制为 n，append 就不会覆盖相邻的缓存。
+		b = a.block[a.off : a.off+n : a.off+n]
+		a.slots[a.off] = slot{cap: n, inUse: true}
+		a.off += n
+		a.live++
+	}
+	a.mu.Unlock()
+	if b == nil {
+		b = make([]byte, n)
+		a.stats.fresh.Add(1)
+		a.track.alloc(b)
+	} else {
+		clear(b) //块中的内存在重新开始之后会被重用
+	}
+	a.stats.alloc(n)
+	return b
+}
+
+// Free hands b back to a. Buffers freed twice or not allocated by a are
+// ignored and counted in the Stats.
+// Free 把 b 交还给 a。被释放两次或不是由 a 分配的缓存会被忽略，并记录在 Stats 中。
+func (a *Arena) Free(b []byte) { a.TryFree(b) }
+
+// TryFree is like Free but reports ErrDoubleFree or ErrForeignFree.
+// TryFree 与 Free 类似，但会报告 ErrDoubleFree 或 ErrForeignFree。
+func (a *Arena) TryFree(b []byte) error {
+	if cap(b) == 0 {
+		return nil
+	}
+	b = b[:cap(b)]
+	off, ok := a.offset(b)
+	if !ok {
+		err := a.track.free(b)
+		a.stats.free(cap(b), err)
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.slots[off]
+	var err error
+	switch {
+	case !ok || s.cap != cap(b):
+		err = ErrForeignFree
+	case !s.inUse:
+		err = ErrDoubleFree
+	default:
+		a.slots[off] = slot{cap: s.cap}
+		if a.live--; a.live == 0 {
+			a.off = 0
+		}
+	}
+	a.stats.free(cap(b), err)
+	return err
+}
+
+// offset returns the offset of b in the block of a, if b starts inside it.
+func (a *Arena) offset(b []byte) (int, bool) {
+	if len(a.block) == 0 {
+		return 0, false
+	}
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(a.block)))
+	p := uintptr(unsafe.Pointer(unsafe.SliceData(b)))
+	if p < start || p >= start+uintptr(len(a.block)) {
+		return 0, false
+	}
+	return int(p - start), true
+}
+
+// Stats returns the usage of a so far.
+// Stats 返回到目前为止 a 的使用情况。
+func (a *Arena) Stats() Stats { return a.stats.stats() }
@@ -0,0 +1,100 @@
+package alloc
+
+import (
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+// Size classes of a Slab: powers of two from 16 bytes to 64 KiB.
+// Slab 的大小等级：从 16 字节到 64 KiB 的 2 的幂。
+const (
+	minClassShift = 4
+	maxClassShift = 16
+	numClasses    = maxClassShift - minClassShift + 1
+)
+
+// A Slab rounds every allocation up to a power-of-two size class and reuses
+// freed buffers of each class through a sync.Pool of that class, so the
+// pools shrink when the allocator is idle. Allocations larger than 64 KiB
+// are made on the heap and dropped when freed. A Slab is safe for
+// concurrent use; its zero value is not, use NewSlab.
+// Slab 把每次分配向上取整到一个 2 的幂的大小等级，并通过每个等级各自的 sync.Pool 重用
+// 该等级被释放的缓存，因此分配器空闲时这些池会收缩。大于 64 KiB 的分配直接在堆上进行，
+// 释放时就被丢弃。Slab 可以被并发使用；它的零值不可用，请使用 NewSlab。
+type Slab struct {
+	classes [numClasses]sync.Pool // of *byte, the first byte of a buffer of the class 缓存的第一个字节
+	track   *tracker
+	stats   counters
+}
+
+// NewSlab returns an empty Slab.
+// NewSlab 返回一个空的 Slab。
+func NewSlab() *Slab { return &Slab{track: new(tracker)} }
+
+// classOf returns the size class of n > 0 bytes, or -1 if n is too large.
+func classOf(n int) int {
+	c := max(bits.Len(uint(n-1)), minClassShift) - minClassShift
+	if c >= numClasses {
+		return -1
+	}
+	return c
+}
+
+func classSize(c int) int { return 1 << (c + minClassShift) }
+
+// Alloc returns a zeroed buffer of length n whose capacity is the size of
+// its class. Alloc(0) returns an empty buffer, which Free ignores.
+// Alloc 返回一个长度为 n、容量为所在等级大小的、内容为零的缓存。Alloc(0) 返回一个
+// 空的缓存，Free 会忽略它。
+func (s *Slab) Alloc(n int) []byte {
+	if n < 0 {
+		panic("alloc: negative size")
+	}
+	if n == 0 {
+		return []byte{}
+	}
+	var b []byte
+	c := classOf(n)
+	if c < 0 {
+		b = make([]byte, n)
+		s.stats.fresh.Add(1)
+	} else if p, ok := s.classes[c].Get().(*byte); ok {
+		//!!! 池中只保存缓存第一个字节的指针，放入与取出都不会产生额外的内存分配。
+		b = unsafe.Slice(p, classSize(c))
+		clear(b[:n])
+	} else {
+		b = make([]byte, classSize(c))
+		s.stats.fresh.Add(1)
+	}
+	s.track.alloc(b)
+	s.stats.alloc(cap(b))
+	return b[:n]
+}
+
+// Free hands b back to s. Buffers freed twice or not allocated by s are
+// ignored and counted in the Stats.
+// Free 把 b 交还给 s。被释放两次或不是由 s 分配的缓存会被忽略，并记录在 Stats 中。
+func (s *Slab) Free(b []byte) { s.TryFree(b) }
+
+// TryFree is like Free but reports ErrDoubleFree or ErrForeignFree.
+// TryFree 与 Free 类似，但会报告 ErrDoubleFree 或 ErrForeignFree。
+func (s *Slab) TryFree(b []byte) error {
+	if cap(b) == 0 {
+		return nil
+	}
+	b = b[:cap(b)]
+	err := s.track.free(b)
+	s.stats.free(cap(b), err)
+	if err != nil {
+		return err
+	}
+	if c := classOf(cap(b)); c >= 0 && classSize(c) == cap(b) {
+		s.classes[c].Put(unsafe.SliceData(b))
+	}
+	return nil
+}
+
+// Stats returns the usage of s so far.
+// Stats 返回到目前为止 s 的使用情况。
+func (s *Slab) Stats() Stats { return s.stats.stats() }
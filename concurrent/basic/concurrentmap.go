@@ -0,0 +1,221 @@
+package basic
+
+import (
+	"hash/maphash"
+	"iter"
+	"maps"
+	"math/bits"
+	"sync"
+)
+
+// !!! TestMakeMapSafeAndGoodReadUsingRWMutex 用一把全局的读写锁保护整个 map，所有的写者
+// !!! （以及与写者同时到达的读者）都在这一把锁上排队。ConcurrentMap 把键按哈希值分散到 N 个分片，
+// !!! 每个分片都有自己的 RWMutex，只有落在同一个分片上的操作才会互相竞争。
+
+// ConcurrentMapOptions configures NewConcurrentMap. The zero value, like a
+// nil pointer, uses 32 shards and a hash/maphash hasher.
+// ConcurrentMapOptions 用于配置 NewConcurrentMap。零值（以及 nil 指针）表示使用 32 个分片，
+// 以及基于 hash/maphash 的哈希函数。
+type ConcurrentMapOptions[K comparable] struct {
+	Shards int // rounded up to a power of two 会被向上取整到 2 的幂
+
+	// Hasher, if not nil, picks the shard of a key. Keys that are equal must
+	// hash equally.
+	// Hasher 不为 nil 时，用于选择键所在的分片。相等的键必须得到相等的哈希值。
+	Hasher func(K) uint64
+}
+
+func (o *ConcurrentMapOptions[K]) shards() int {
+	if o == nil || o.Shards <= 0 {
+		return 32
+	}
+	return 1 << bits.Len(uint(o.Shards-1))
+}
+
+func (o *ConcurrentMapOptions[K]) hasher() func(K) uint64 {
+	if o == nil || o.Hasher == nil {
+		seed := maphash.MakeSeed()
+		return func(k K) uint64 { return maphash.Comparable(seed, k) }
+	}
+	return o.Hasher
+}
+
+// ConcurrentMap is a map safe for concurrent use that is split into shards,
+// each guarded by its own sync.RWMutex, so that goroutines working on
+// different keys rarely wait for each other.
+// ConcurrentMap 是一个可以被并发使用的 map，它被分成若干分片，每个分片由自己的 sync.RWMutex
+// 保护，因此操作不同键的 goroutine 很少需要互相等待。
+type ConcurrentMap[K comparable, V any] struct {
+	shards []cmShard[K, V]
+	mask   uint64
+	hash   func(K) uint64
+}
+
+type cmShard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+	_  [64]byte //!!! 填充到不同的缓存行，避免相邻分片的锁之间的伪共享（false sharing）。
+}
+
+// NewConcurrentMap returns an empty ConcurrentMap configured by opts, which
+// may be nil.
+// NewConcurrentMap 返回一个按照 opts（可以为 nil）配置的空 ConcurrentMap。
+func NewConcurrentMap[K comparable, V any](opts *ConcurrentMapOptions[K]) *ConcurrentMap[K, V] {
+	n := opts.shards()
+	m := &ConcurrentMap[K, V]{
+		shards: make([]cmShard[K, V], n),
+		mask:   uint64(n - 1),
+		hash:   opts.hasher(),
+	}
+	for i := range m.shards {
+		m.shards[i].m = make(map[K]V)
+	}
+	return m
+}
+
+func (m *ConcurrentMap[K, V]) shard(key K) *cmShard[K, V] {
+	return &m.shards[m.hash(key)&m.mask]
+}
+
+// Load returns the value stored for key, if any.
+// Load 返回 key 所对应的值（如果有的话）。
+func (m *ConcurrentMap[K, V]) Load(key K) (value V, ok bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	value, ok = s.m[key]
+	s.mu.RUnlock()
+	return value, ok
+}
+
+// Store sets the value for key.
+// Store 设置 key 所对应的值。
+func (m *ConcurrentMap[K, V]) Store(key K, value V) {
+	s := m.shard(key)
+	s.mu.Lock()
+	s.m[key] = value
+	s.mu.Unlock()
+}
+
+// LoadOrStore returns the existing value for key if present. Otherwise it
+// stores and returns value. loaded reports whether the value was loaded.
+// LoadOrStore 在 key 存在时返回已有的值；否则存储并返回 value。loaded 报告值是否是加载的。
+func (m *ConcurrentMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	if actual, loaded = m.Load(key); loaded {
+		return actual, true
+	}
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//在释放读锁与获得写锁之间，别的 goroutine 可能已经存储了 key。
+	if actual, loaded = s.m[key]; loaded {
+		return actual, true
+	}
+	s.m[key] = value
+	return value, false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value if any.
+// LoadAndDelete 删除 key 所对应的值，并返回之前的值（如果有的话）。
+func (m *ConcurrentMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	value, loaded = s.m[key]
+	delete(s.m, key)
+	s.mu.Unlock()
+	return value, loaded
+}
+
+// Delete deletes the value for key.
+// Delete 删除 key 所对应的值。
+func (m *ConcurrentMap[K, V]) Delete(key K) {
+	m.LoadAndDelete(key)
+}
+
+// Compute atomically replaces the value of key with the result of f, which
+// is called with the current value and whether key is present. If f
+// returns del, key is deleted instead. Compute returns the new value and
+// whether key is now present. f runs with the shard locked, so it must be
+// quick and must not use m.
+// Compute 原子地把 key 的值替换为 f 的结果，调用 f 时传入当前的值以及 key 是否存在。
+// 如果 f 返回 del 为 true，则改为删除 key。Compute 返回新的值以及 key 现在是否存在。
+// f 运行时分片是锁住的，所以它必须很快完成，并且不能使用 m。
+func (m *ConcurrentMap[K, V]) Compute(key K, f func(old V, loaded bool) (value V, del bool)) (value V, ok bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, loaded := s.m[key]
+	value, del := f(old, loaded)
+	if del {
+		delete(s.m, key)
+		var zero V
+		return zero, false
+	}
+	s.m[key] = value
+	return value, true
+}
+
+// Upsert stores value for key if it is absent, and merge(old, value)
+// otherwise, atomically, returning what it stored. merge runs with the
+// shard locked, like the f of Compute.
+// Upsert 在 key 不存在时存储 value，否则原子地存储 merge(old, value)，并返回存储的值。
+// 与 Compute 的 f 一样，merge 运行时分片是锁住的。
+func (m *ConcurrentMap[K, V]) Upsert(key K, value V, merge func(old, value V) V) V {
+	v, _ := m.Compute(key, func(old V, loaded bool) (V, bool) {
+		if loaded {
+			return merge(old, value), false
+		}
+		return value, false
+	})
+	return v
+}
+
+// Len returns the number of entries.
+// Len 返回条目的数量。
+func (m *ConcurrentMap[K, V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// All returns an iterator over the entries of m. Each shard is copied under
+// its read lock and yielded without it, so the loop body may use m; the
+// entries of a shard are a consistent snapshot, but shards are copied one
+// after another.
+// All 返回一个遍历 m 中条目的迭代器。每个分片在持有读锁时被拷贝，在不持有锁时被产出，
+// 所以循环体中可以使用 m；同一分片中的条目是一致的快照，但各个分片是先后拷贝的。
+func (m *ConcurrentMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for i := range m.shards {
+			for k, v := range m.shards[i].clone() {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Snapshot returns a copy of m as a plain map, with the same consistency
+// as All.
+// Snapshot 以普通 map 的形式返回 m 的一份拷贝，一致性与 All 相同。
+func (m *ConcurrentMap[K, V]) Snapshot() map[K]V {
+	out := make(map[K]V, m.Len())
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		maps.Copy(out, s.m)
+		s.mu.RUnlock()
+	}
+	return out
+}
+
+func (s *cmShard[K, V]) clone() map[K]V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.m)
+}
@@ -0,0 +1,78 @@
+package basic
+
+import (
+	"maps"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentMapBasic(t *testing.T) {
+	m := NewConcurrentMap[string, int](nil)
+	if len(m.shards) != 32 {
+		t.Errorf("%d shards by default", len(m.shards))
+	}
+	m.Store("a", 1)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Fatalf("Load = %d, %v", v, ok)
+	}
+	if v, loaded := m.LoadOrStore("a", 2); !loaded || v != 1 {
+		t.Errorf("LoadOrStore existing = %d, %v", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("b", 2); loaded || v != 2 {
+		t.Errorf("LoadOrStore new = %d, %v", v, loaded)
+	}
+	if v, ok := m.Compute("b", func(old int, loaded bool) (int, bool) { return old, true }); ok || v != 0 {
+		t.Errorf("Compute delete = %d, %v", v, ok)
+	}
+	if v, loaded := m.LoadAndDelete("b"); loaded {
+		t.Errorf("b still present: %d", v)
+	}
+	if got := m.Upsert("a", 5, func(old, v int) int { return old + v }); got != 6 {
+		t.Errorf("Upsert = %d, want 6", got)
+	}
+	if got := m.Snapshot(); !maps.Equal(got, map[string]int{"a": 6}) || m.Len() != 1 {
+		t.Errorf("Snapshot = %v, Len = %d", got, m.Len())
+	}
+}
+
+func TestConcurrentMapUpsertConcurrent(t *testing.T) {
+	//所有的键都落在同一个分片上，Hasher 与分片数都应该只影响性能，不影响结果。
+	for _, opts := range []*ConcurrentMapOptions[int]{nil, {Shards: 5, Hasher: func(int) uint64 { return 7 }}} {
+		m := NewConcurrentMap[int, int](opts)
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Go(func() {
+				for i := range 1000 {
+					m.Upsert(i%10, 1, func(old, v int) int { return old + v })
+				}
+			})
+		}
+		wg.Wait()
+		for k, v := range m.All() {
+			if v != 800 {
+				t.Errorf("shards %d: key %d counted %d, want 800", len(m.shards), k, v)
+			}
+		}
+		if m.Len() != 10 {
+			t.Errorf("Len = %d", m.Len())
+		}
+	}
+}
+
+func TestConcurrentMapAllMayWrite(t *testing.T) {
+	m := NewConcurrentMap[int, int](&ConcurrentMapOptions[int]{Shards: 4})
+	for i := range 100 {
+		m.Store(i, i)
+	}
+	//循环体中写同一个 map 不会死锁，因为 All 产出时不持有锁。
+	n := 0
+	for k := range m.All() {
+		m.Delete(k)
+		if n++; n == 60 {
+			break
+		}
+	}
+	if m.Len() != 40 {
+		t.Errorf("Len = %d after deleting 60 of 100", m.Len())
+	}
+}
@@ -1 +1,426 @@
 package basic
+
+import (
+	"hash/maphash"
+	"sync/atomic"
+)
+
+// !!! LockFreeMap 是一个只使用原子操作（没有任何锁）的并发哈希表。
+// !!! 每个桶（bucket）都是不可变的：写操作复制一份修改后的桶，再用 CompareAndSwap 替换桶指针，
+// !!! CAS 失败就说明有人抢先修改了这个桶，重新读取后再试。读操作只需原子地加载桶指针，从不等待。
+// !!! 扩容不会“停止整个世界”：扩容时创建一个两倍大小的新表，旧表的桶被逐个“冻结”并拆分到新表中。
+// !!! 每个写操作都顺带迁移一小块桶，访问新表中尚未填充的桶时则先迁移它的来源桶，
+// !!! 所以迁移的工作由所有的写者分摊，任何时候其他 goroutine 都可以继续读写。
+
+const (
+	lfMinBuckets   = 8  // buckets of a new map 新建的表中桶的数量
+	lfMigrateChunk = 16 // old buckets a writer migrates while a resize is running 扩容期间每个写者迁移的旧桶数量
+)
+
+// LockFreeMap is a hash map safe for concurrent use that uses no locks:
+// buckets are immutable and replaced with compare-and-swap, and the table
+// grows incrementally, with every writer migrating a few buckets, so that
+// no operation ever waits for a resize. Load never writes. Like sync.Map,
+// the zero value is an empty map ready to use, and it must not be copied
+// after first use.
+// LockFreeMap 是一个可以被并发使用、不使用任何锁的哈希表：桶是不可变的，用比较并交换（CAS）
+// 来替换；表是增量扩容的，每个写者都迁移几个桶，所以任何操作都不会等待扩容。Load 从不写入。
+// 与 sync.Map 一样，它的零值就是一个可以直接使用的空表，第一次使用之后就不能再被拷贝。
+type LockFreeMap[K comparable, V any] struct {
+	table atomic.Pointer[lfTable[K, V]] // the newest table that is completely filled 完全填充好的最新的表
+	count atomic.Int64
+}
+
+// An lfTable is an array of buckets. While it grows, next is the table
+// twice its size that replaces it; the buckets of next are filled from
+// prev, bucket by bucket, and nil in next means not filled yet.
+// lfTable 是一个桶的数组。扩容期间，next 是替代它的、大小为它两倍的表；next 的桶从 prev
+// 逐个填充，next 中的 nil 表示尚未填充。
+type lfTable[K comparable, V any] struct {
+	seed    maphash.Seed
+	buckets []atomic.Pointer[lfBucket[K, V]]
+	mask    uint64
+	prev    atomic.Pointer[lfTable[K, V]] // the table being migrated into this one 正在迁移到本表的旧表
+	next    atomic.Pointer[lfTable[K, V]] // the table this one is migrating into 本表正在迁移到的新表
+	claimed atomic.Int64                  // buckets of this table claimed for migration 已被认领迁移的本表的桶数
+	filled  atomic.Int64                  // buckets of this table filled from prev 本表中已从 prev 填充的桶数
+}
+
+// An lfBucket is never modified once published. A frozen bucket has been
+// migrated, and its entries live on in the next table.
+// lfBucket 一经发布就不再修改。被冻结（frozen）的桶已经迁移，它的条目在下一个表中继续存在。
+type lfBucket[K comparable, V any] struct {
+	entries []lfEntry[K, V]
+	frozen  bool
+}
+
+type lfEntry[K comparable, V any] struct {
+	hash  uint64
+	key   K
+	value V
+}
+
+func newLFTable[K comparable, V any](seed maphash.Seed, size int) *lfTable[K, V] {
+	return &lfTable[K, V]{
+		seed:    seed,
+		buckets: make([]atomic.Pointer[lfBucket[K, V]], size),
+		mask:    uint64(size - 1),
+	}
+}
+
+func (b *lfBucket[K, V]) find(hash uint64, key K) int {
+	if b == nil {
+		return -1
+	}
+	for i := range b.entries {
+		if b.entries[i].hash == hash && b.entries[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// with returns a copy of b with entry i replaced by e, or e appended if i < 0.
+func (b *lfBucket[K, V]) with(i int, e lfEntry[K, V]) *lfBucket[K, V] {
+	var entries []lfEntry[K, V]
+	if b != nil {
+		entries = make([]lfEntry[K, V], len(b.entries), len(b.entries)+1)
+		copy(entries, b.entries)
+	}
+	if i < 0 {
+		entries = append(entries, e)
+	} else {
+		entries[i] = e
+	}
+	return &lfBucket[K, V]{entries: entries}
+}
+
+// without returns a copy of b without entry i. It is never nil, since nil
+// means not filled yet in a growing table.
+func (b *lfBucket[K, V]) without(i int) *lfBucket[K, V] {
+	entries := make([]lfEntry[K, V], 0, len(b.entries)-1)
+	entries = append(entries, b.entries[:i]...)
+	entries = append(entries, b.entries[i+1:]...)
+	return &lfBucket[K, V]{entries: entries}
+}
+
+// loadTable returns the current table, creating it on first use.
+func (m *LockFreeMap[K, V]) loadTable() *lfTable[K, V] {
+	if t := m.table.Load(); t != nil {
+		return t
+	}
+	m.table.CompareAndSwap(nil, newLFTable[K, V](maphash.MakeSeed(), lfMinBuckets))
+	return m.table.Load()
+}
+
+// Load returns the value stored for key, if any.
+// Load 返回 key 所对应的值（如果有的话）。
+func (m *LockFreeMap[K, V]) Load(key K) (value V, ok bool) {
+	t := m.table.Load()
+	if t == nil {
+		return value, false
+	}
+	h := maphash.Comparable(t.seed, key)
+	b := m.readBucket(t, h)
+	if i := b.find(h, key); i >= 0 {
+		return b.entries[i].value, true
+	}
+	return value, false
+}
+
+// readBucket returns a bucket holding the current entries of hash,
+// starting at t and following resizes without helping them.
+// readBucket 从 t 开始、顺着扩容（但不参与扩容）找到一个持有 hash 当前条目的桶。
+func (m *LockFreeMap[K, V]) readBucket(t *lfTable[K, V], h uint64) *lfBucket[K, V] {
+	for {
+		j := h & t.mask
+		b := t.buckets[j].Load()
+		switch {
+		case b != nil && b.frozen:
+			t = t.next.Load()
+		case b == nil:
+			if p := t.prev.Load(); p != nil {
+				//!!! 桶还没有从旧表填充，旧表中的桶（无论是否已冻结）就是它当前的内容。
+				return p.buckets[h&p.mask].Load()
+			}
+			//!!! prev 可能刚刚在迁移完成后被清除，此时这个桶已被填充，重新读取。
+			if t.buckets[j].Load() == nil {
+				return nil
+			}
+		default:
+			return b
+		}
+	}
+}
+
+// writableBucket returns the table, index and bucket in which the entries
+// of hash can be modified, migrating the bucket first if needed. A nil
+// bucket is empty.
+// writableBucket 返回可以修改 hash 条目的表、下标与桶，必要时先迁移这个桶。nil 桶表示空桶。
+func (m *LockFreeMap[K, V]) writableBucket(t *lfTable[K, V], h uint64) (*lfTable[K, V], uint64, *lfBucket[K, V]) {
+	for {
+		j := h & t.mask
+		b := t.buckets[j].Load()
+		switch {
+		case b != nil && b.frozen:
+			t = t.next.Load()
+		case b == nil:
+			p := t.prev.Load()
+			if p == nil {
+				//如果其实是 prev 刚被清除、桶已经填充，那么之后的 CAS 会失败并重试。
+				return t, j, nil
+			}
+			m.migrate(p, h&p.mask)
+		default:
+			return t, j, b
+		}
+	}
+}
+
+type lfOp int
+
+const (
+	lfKeep lfOp = iota
+	lfSet
+	lfDelete
+)
+
+// update calls f with the current value of key and applies its decision,
+// retrying from the start whenever another writer changed the bucket first.
+// update 以 key 的当前值调用 f 并执行它的决定；只要有别的写者抢先修改了这个桶，就从头重试。
+func (m *LockFreeMap[K, V]) update(key K, f func(old V, loaded bool) (V, lfOp)) (old V, loaded bool) {
+	t := m.loadTable()
+	h := maphash.Comparable(t.seed, key)
+	for {
+		var j uint64
+		var b *lfBucket[K, V]
+		t, j, b = m.writableBucket(t, h)
+		i := b.find(h, key)
+		var zero V
+		old, loaded = zero, i >= 0
+		if loaded {
+			old = b.entries[i].value
+		}
+		v, op := f(old, loaded)
+		var nb *lfBucket[K, V]
+		switch {
+		case op == lfKeep || op == lfDelete && !loaded:
+			return old, loaded
+		case op == lfDelete:
+			nb = b.without(i)
+		default:
+			nb = b.with(i, lfEntry[K, V]{h, key, v})
+		}
+		if !t.buckets[j].CompareAndSwap(b, nb) {
+			continue
+		}
+		switch {
+		case op == lfDelete:
+			m.count.Add(-1)
+		case !loaded:
+			if m.count.Add(1) > int64(len(t.buckets)) {
+				m.grow(t)
+			}
+		}
+		m.helpResize()
+		return old, loaded
+	}
+}
+
+// Store sets the value for key.
+// Store 设置 key 所对应的值。
+func (m *LockFreeMap[K, V]) Store(key K, value V) {
+	m.update(key, func(V, bool) (V, lfOp) { return value, lfSet })
+}
+
+// LoadOrStore returns the existing value for key if present. Otherwise it
+// stores and returns value. loaded reports whether the value was loaded.
+// LoadOrStore 在 key 存在时返回已有的值；否则存储并返回 value。loaded 报告值是否是加载的。
+func (m *LockFreeMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	if v, ok := m.Load(key); ok {
+		return v, true
+	}
+	actual, loaded = m.update(key, func(old V, loaded bool) (V, lfOp) {
+		if loaded {
+			return old, lfKeep
+		}
+		return value, lfSet
+	})
+	if !loaded {
+		actual = value
+	}
+	return actual, loaded
+}
+
+// CompareAndSwap stores new for key if its value is equal to old. Like
+// sync.Map, it panics if the values are not comparable.
+// CompareAndSwap 在 key 的值等于 old 时把它设置为 new。与 sync.Map 一样，值不可比较时会 panic。
+func (m *LockFreeMap[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	m.update(key, func(cur V, loaded bool) (V, lfOp) {
+		if !loaded || any(cur) != any(old) {
+			return cur, lfKeep
+		}
+		swapped = true
+		return new, lfSet
+	})
+	return swapped
+}
+
+// Delete deletes the value for key.
+// Delete 删除 key 所对应的值。
+func (m *LockFreeMap[K, V]) Delete(key K) {
+	if m.table.Load() == nil {
+		return
+	}
+	m.update(key, func(old V, _ bool) (V, lfOp) { return old, lfDelete })
+}
+
+// Len returns the number of entries. It is only a snapshot while other
+// goroutines write.
+// Len 返回条目的数量。当其他 goroutine 正在写入时，它只是一个快照。
+func (m *LockFreeMap[K, V]) Len() int { return int(m.count.Load()) }
+
+// Range calls f for each key and value until f returns false. Like
+// sync.Map.Range, it visits each key at most once but is not a consistent
+// snapshot; it may be called while the map is modified or grows.
+// Range 对每一对键值调用 f，直到 f 返回 false。与 sync.Map.Range 一样，每个键最多只访问一次，
+// 但并不是一致的快照；在表被修改或者扩容的同时也可以调用它。
+func (m *LockFreeMap[K, V]) Range(f func(key K, value V) bool) {
+	t := m.table.Load()
+	if t == nil {
+		return
+	}
+	for j := range t.buckets {
+		if !m.rangeBucket(t, uint64(j), f) {
+			return
+		}
+	}
+}
+
+// rangeBucket calls f for the entries whose hash maps to bucket j of t.
+func (m *LockFreeMap[K, V]) rangeBucket(t *lfTable[K, V], j uint64, f func(K, V) bool) bool {
+	b := t.buckets[j].Load()
+	switch {
+	case b != nil && b.frozen:
+		//!!! 冻结的桶被拆分成了新表中的两个桶：j 与 j+len(t.buckets)。
+		n := t.next.Load()
+		return m.rangeBucket(n, j, f) && m.rangeBucket(n, j+uint64(len(t.buckets)), f)
+	case b == nil:
+		if p := t.prev.Load(); p != nil {
+			//桶还没有填充，旧表中对应的桶里属于这个桶的那些条目就是它的内容。
+			if pb := p.buckets[j&p.mask].Load(); pb != nil {
+				for _, e := range pb.entries {
+					if e.hash&t.mask == j && !f(e.key, e.value) {
+						return false
+					}
+				}
+			}
+			return true
+		}
+		if t.buckets[j].Load() != nil {
+			return m.rangeBucket(t, j, f)
+		}
+		return true
+	}
+	for _, e := range b.entries {
+		if !f(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// grow starts migrating t into a table twice its size, unless t is
+// already migrating or is itself still being filled.
+// grow 开始把 t 迁移到一个两倍大小的表中，除非 t 已经在迁移，或者它自己还在被填充。
+func (m *LockFreeMap[K, V]) grow(t *lfTable[K, V]) {
+	if t.next.Load() != nil || t.prev.Load() != nil {
+		return
+	}
+	n := newLFTable[K, V](t.seed, 2*len(t.buckets))
+	n.prev.Store(t)
+	t.next.CompareAndSwap(nil, n)
+}
+
+// helpResize migrates a chunk of buckets of the current table, if it is
+// migrating.
+// helpResize 在当前的表正在迁移时，迁移其中的一块桶。
+func (m *LockFreeMap[K, V]) helpResize() {
+	t := m.advance()
+	if t.next.Load() == nil {
+		return
+	}
+	size := int64(len(t.buckets))
+	start := t.claimed.Add(lfMigrateChunk) - lfMigrateChunk
+	for i := start; i < min(start+lfMigrateChunk, size); i++ {
+		m.migrate(t, uint64(i))
+	}
+}
+
+// migrate freezes bucket i of o and fills the two buckets of o.next it
+// splits into. Any number of goroutines may migrate the same bucket; the
+// first to freeze it and the first to fill each half win.
+// migrate 冻结 o 的第 i 个桶，并填充它在 o.next 中拆分成的两个桶。任意多个 goroutine 都可以
+// 迁移同一个桶：第一个冻结它的、以及第一个填充每一半的 goroutine 胜出。
+func (m *LockFreeMap[K, V]) migrate(o *lfTable[K, V], i uint64) {
+	var frozen *lfBucket[K, V]
+	for frozen == nil {
+		b := o.buckets[i].Load()
+		if b != nil && b.frozen {
+			frozen = b
+			break
+		}
+		//o 自己已经填充完毕才会开始迁移，所以这里的 nil 就是空桶。
+		f := &lfBucket[K, V]{frozen: true}
+		if b != nil {
+			f.entries = b.entries //条目切片是不可变的，可以共享
+		}
+		if o.buckets[i].CompareAndSwap(b, f) {
+			frozen = f
+		}
+	}
+	size := uint64(len(o.buckets))
+	var lo, hi []lfEntry[K, V]
+	for _, e := range frozen.entries {
+		if e.hash&size == 0 {
+			lo = append(lo, e)
+		} else {
+			hi = append(hi, e)
+		}
+	}
+	n := o.next.Load()
+	m.fill(n, i, lo)
+	m.fill(n, i+size, hi)
+}
+
+// fill fills bucket j of n with entries, unless it is filled already. The
+// goroutine that fills the last bucket makes n the current table.
+// fill 用 entries 填充 n 的第 j 个桶（除非它已经被填充）。填充最后一个桶的 goroutine 让 n
+// 成为当前的表。
+func (m *LockFreeMap[K, V]) fill(n *lfTable[K, V], j uint64, entries []lfEntry[K, V]) {
+	if n.buckets[j].Load() != nil || !n.buckets[j].CompareAndSwap(nil, &lfBucket[K, V]{entries: entries}) {
+		return
+	}
+	if n.filled.Add(1) == int64(len(n.buckets)) {
+		n.prev.Store(nil) //!!! 所有的桶都已填充，不再需要旧表，它可以被垃圾回收了。
+		m.advance()
+	}
+}
+
+// advance moves m.table past every table whose next is completely filled
+// and returns the result. A single compare-and-swap from n.prev to n is not
+// enough: once prev is cleared n may grow again, and if its next fills
+// before m.table reaches n, that CAS would pin m.table to n for good.
+// advance 把 m.table 向前移动，越过每一个 next 已经完全填充的表，并返回结果。从 n.prev 到 n
+// 的单次 CAS 是不够的：prev 一被清除，n 就可能再次扩容，如果在 m.table 到达 n 之前它的 next
+// 就已经填充完，那次 CAS 会让 m.table 永远停留在 n 上。
+func (m *LockFreeMap[K, V]) advance() *lfTable[K, V] {
+	for {
+		t := m.table.Load()
+		n := t.next.Load()
+		if n == nil || n.filled.Load() < int64(len(n.buckets)) {
+			return t
+		}
+		m.table.CompareAndSwap(t, n)
+	}
+}
@@ -0,0 +1,252 @@
+package basic
+
+import (
+	"math/rand/v2"
+	"sync"
+	"testing"
+)
+
+func TestLockFreeMapBasic(t *testing.T) {
+	var m LockFreeMap[string, int]
+	if _, ok := m.Load("a"); ok {
+		t.Fatal("zero map is not empty")
+	}
+	m.Delete("a")
+	m.Store("a", 1)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Fatalf("Load = %d, %v", v, ok)
+	}
+	if v, loaded := m.LoadOrStore("a", 2); !loaded || v != 1 {
+		t.Errorf("LoadOrStore existing = %d, %v", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("b", 2); loaded || v != 2 {
+		t.Errorf("LoadOrStore new = %d, %v", v, loaded)
+	}
+	if m.CompareAndSwap("a", 5, 6) || m.CompareAndSwap("c", 0, 6) {
+		t.Error("CompareAndSwap swapped a wrong or missing value")
+	}
+	if !m.CompareAndSwap("a", 1, 3) {
+		t.Error("CompareAndSwap did not swap")
+	}
+	m.Delete("b")
+	got := map[string]int{}
+	m.Range(func(k string, v int) bool { got[k] = v; return true })
+	if len(got) != 1 || got["a"] != 3 || m.Len() != 1 {
+		t.Errorf("Range = %v, Len = %d", got, m.Len())
+	}
+}
+
+func TestLockFreeMapGrow(t *testing.T) {
+	var m LockFreeMap[int, int]
+	const n = 10000
+	for i := range n {
+		m.Store(i, i)
+	}
+	for i := 0; i < n; i += 2 {
+		m.Delete(i)
+	}
+	if m.Len() != n/2 {
+		t.Fatalf("Len = %d, want %d", m.Len(), n/2)
+	}
+	for i := range n {
+		if v, ok := m.Load(i); ok != (i%2 == 1) || ok && v != i {
+			t.Fatalf("Load(%d) = %d, %v", i, v, ok)
+		}
+	}
+	//表已经扩容了好几次，旧表都应该已经迁移完并被丢弃。
+	if tb := m.table.Load(); len(tb.buckets) < n/2 || tb.prev.Load() != nil {
+		t.Errorf("%d buckets after %d stores", len(tb.buckets), n)
+	}
+}
+
+// TestLockFreeMapAdvancePastStaleTable 模拟 fill 发布新表之前又发生了两次扩容的情形：
+// m.table 停留在一张已经迁移完的旧表上，下一次操作应该把它推进到最新的表。
+func TestLockFreeMapAdvancePastStaleTable(t *testing.T) {
+	var m LockFreeMap[int, int]
+	m.Store(0, 0)
+	stale := m.table.Load()
+	for i := 1; len(m.table.Load().buckets) < 4*len(stale.buckets); i++ {
+		m.Store(i, i)
+	}
+	newest := m.table.Load()
+	m.table.Store(stale)
+	m.Store(-1, -1)
+	if tb := m.table.Load(); len(tb.buckets) < len(newest.buckets) {
+		t.Errorf("table has %d buckets, want at least %d", len(tb.buckets), len(newest.buckets))
+	}
+	if v, ok := m.Load(0); !ok || v != 0 {
+		t.Errorf("Load(0) = %d, %v", v, ok)
+	}
+}
+
+func TestLockFreeMapConcurrent(t *testing.T) {
+	var m LockFreeMap[int, int]
+	const goroutines, perG = 8, 2000
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Go(func() {
+			//每个 goroutine 写自己的键，同时读别人的键，整个过程中表在不断扩容。
+			for i := range perG {
+				k := g*perG + i
+				m.Store(k, 0)
+				if !m.CompareAndSwap(k, 0, k) {
+					t.Errorf("CompareAndSwap(%d) failed", k)
+				}
+				if v, ok := m.Load(k); !ok || v != k {
+					t.Errorf("Load(%d) = %d, %v", k, v, ok)
+				}
+				m.Load(rand.IntN(goroutines * perG))
+				if i%3 == 0 {
+					m.Delete(k)
+				}
+			}
+		})
+	}
+	wg.Go(func() {
+		for range 20 {
+			seen := map[int]bool{}
+			m.Range(func(k, v int) bool {
+				if seen[k] || v != 0 && v != k {
+					t.Errorf("Range visited %d=%d, seen before: %v", k, v, seen[k])
+				}
+				seen[k] = true
+				return true
+			})
+		}
+	})
+	wg.Wait()
+
+	want := 0
+	for g := range goroutines {
+		for i := range perG {
+			_, ok := m.Load(g*perG + i)
+			if ok != (i%3 != 0) {
+				t.Fatalf("key %d present: %v", g*perG+i, ok)
+			}
+			if ok {
+				want++
+			}
+		}
+	}
+	n := 0
+	m.Range(func(int, int) bool { n++; return true })
+	if n != want || m.Len() != want {
+		t.Errorf("Range visited %d, Len %d, want %d", n, m.Len(), want)
+	}
+}
+
+func TestLockFreeMapLoadOrStoreRace(t *testing.T) {
+	var m LockFreeMap[int, int]
+	for k := range 100 {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		stored := 0
+		for g := range 8 {
+			wg.Go(func() {
+				if v, loaded := m.LoadOrStore(k, g); !loaded {
+					mu.Lock()
+					stored++
+					mu.Unlock()
+				} else if got, _ := m.Load(k); got != v {
+					t.Errorf("LoadOrStore loaded %d, Load %d", v, got)
+				}
+			})
+		}
+		wg.Wait()
+		if stored != 1 {
+			t.Fatalf("key %d stored by %d goroutines", k, stored)
+		}
+	}
+}
+
+// 以下的基准测试把 LockFreeMap 与 TestMakeMapSafeUsingMutex、TestMakeMapSafeAndGoodReadUsingRWMutex
+// 中用一把锁保护的 map、分片的 ConcurrentMap 以及 sync.Map 做比较，分别在读多写少（90% 读）与写多（50% 写）的负载下运行。
+type intMap interface {
+	Load(k int) (int, bool)
+	Store(k, v int)
+}
+
+type mutexMap struct {
+	lock sync.Mutex
+	m    map[int]int
+}
+
+func (m *mutexMap) Load(k int) (int, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.m[k]
+	return v, ok
+}
+
+func (m *mutexMap) Store(k, v int) {
+	m.lock.Lock()
+	m.m[k] = v
+	m.lock.Unlock()
+}
+
+type rwmutexMap struct {
+	lock sync.RWMutex
+	m    map[int]int
+}
+
+func (m *rwmutexMap) Load(k int) (int, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	v, ok := m.m[k]
+	return v, ok
+}
+
+func (m *rwmutexMap) Store(k, v int) {
+	m.lock.Lock()
+	m.m[k] = v
+	m.lock.Unlock()
+}
+
+type syncMap struct{ m sync.Map }
+
+func (m *syncMap) Load(k int) (int, bool) {
+	v, ok := m.m.Load(k)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+
+func (m *syncMap) Store(k, v int) { m.m.Store(k, v) }
+
+const benchKeys = 1 << 12
+
+func benchmarkMaps(b *testing.B, writePercent int) {
+	for _, bm := range []struct {
+		name string
+		new  func() intMap
+	}{
+		{"LockFree", func() intMap { return new(LockFreeMap[int, int]) }},
+		{"Sharded", func() intMap { return NewConcurrentMap[int, int](nil) }},
+		{"Mutex", func() intMap { return &mutexMap{m: map[int]int{}} }},
+		{"RWMutex", func() intMap { return &rwmutexMap{m: map[int]int{}} }},
+		{"SyncMap", func() intMap { return new(syncMap) }},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			m := bm.new()
+			for i := range benchKeys {
+				m.Store(i, i)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewPCG(rand.Uint64(), 0))
+				for pb.Next() {
+					k := r.IntN(benchKeys)
+					if r.IntN(100) < writePercent {
+						m.Store(k, k)
+					} else {
+						m.Load(k)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkMapReadHeavy(b *testing.B)  { benchmarkMaps(b, 10) }
+func BenchmarkMapWriteHeavy(b *testing.B) { benchmarkMaps(b, 50) }
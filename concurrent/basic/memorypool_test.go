@@ -59,6 +59,8 @@ import (
 	"strings"
 	"sync"
 	"testing"
+
+	"com.example/golearn/concurrent/alloc"
 )
 
 // 存储1024个"how now brown cow"字符串的压缩结果
@@ -147,7 +149,7 @@ const maxalloc int = 9
 // the pooled allocators.
 // 人为的基准测试：从此bigcow 读取器（reader）中读取10个或maxalloc-1个字节到一个
 // 按照对应大小所分配buffer中。一次性持有50块分配的内存用于测试池化的内存分配。
-func allocloop(b *testing.B, r io.ReadSeeker, m alloc) {
+func allocloop(b *testing.B, r io.ReadSeeker, m alloc.Allocator) {
 	for i := 0; i < b.N; i++ {
 		var bufs [50][]byte
 		for i := range bufs {
@@ -174,26 +176,6 @@ func allocloop(b *testing.B, r io.ReadSeeker, m alloc) {
 	}
 }
 
-// alloc定义了内存分配器的接口
-type alloc interface {
-	Alloc(n int) []byte
-	Free([]byte)
-}
-
-// profile heap allocations with a simple wrapper for
-// the alloc interface; frees are implicit with Go's GC.
-// 使用alloc接口的简单的封装器来剖析（profile）对内存的分配；
-// 隐含使用Go的垃圾回收器（GC）进行内存释放。
-type heap struct{}
-
-func (*heap) Alloc(n int) []byte {
-	//私用make函数构建一个byte切片
-	return make([]byte, n)
-}
-
-// 释放内存 ，实际上什么都没做，利用go的GC机制释放内存
-func (*heap) Free([]byte) {}
-
 var rcow = bytes.NewReader(buf)
 
 func BenchmarkHeapAlloc(b *testing.B) {
@@ -202,7 +184,22 @@ func BenchmarkHeapAlloc(b *testing.B) {
 	for _, vi := range buf {
 		println(uint8(vi))
 	}
-	allocloop(b, rcow, &heap{})
+	allocloop(b, rcow, alloc.Heap{})
+}
+
+// 内存分配器的接口（alloc.Allocator）以及按大小等级池化的Slab、固定容量的Arena都在alloc包中，
+// 在这里用同一个allocloop对比它们，并报告每次循环中需要在堆上新建的缓存数（fresh/op）。
+// 包级变量先于init函数初始化，rcow创建时buf还是空的，所以它们各自读取init之后的buf。
+func BenchmarkSlabAlloc(b *testing.B) {
+	m := alloc.NewSlab()
+	allocloop(b, bytes.NewReader(buf), m)
+	b.ReportMetric(float64(m.Stats().Fresh)/float64(b.N), "fresh/op")
+}
+
+func BenchmarkArenaAlloc(b *testing.B) {
+	m := alloc.NewArena(50 * 10) //一次循环最多持有50块10个字节的缓存
+	allocloop(b, bytes.NewReader(buf), m)
+	b.ReportMetric(float64(m.Stats().Fresh)/float64(b.N), "fresh/op")
 }
 func TestPoolBiehavior(t *testing.T) {
 	//定义被存储在内存池中的值的类型。
@@ -0,0 +1,137 @@
+// Package compresspool reuses gzip, zlib and flate readers and writers
+// through sync.Pools, as BenchmarkGunzipPooled in
+// concurrent/basic/memorypool_test.go does for gzip.Reader, so that a
+// service does not allocate a compressor or decompressor per request.
+//
+// Every Get function returns a wrapper around a pooled object that has
+// been Reset onto the given stream. Close finishes the stream and returns
+// the object to the pool; the matching Put function returns it without
+// finishing the stream. Either way the wrapper must not be used afterwards,
+// and closing or putting it again does nothing.
+// compresspool 包通过 sync.Pool 重用 gzip、zlib 与 flate 的读取器和写入器，就像
+// concurrent/basic/memorypool_test.go 中的 BenchmarkGunzipPooled 对 gzip.Reader 所做的那样，
+// 这样服务就不必为每个请求分配一个压缩器或者解压缩器。
+//
+// 每个 Get 函数都返回一个包装器，其中是从池中取出、并已经 Reset 到给定流上的对象。
+// Close 结束这个流并把对象交还给池；对应的 Put 函数则不结束流，直接交还对象。无论哪种方式，
+// 之后都不能再使用这个包装器，再次关闭或者交还它什么也不做。
+package compresspool
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// levelPools holds one pool of writers per compression level, because
+// Reset keeps the level a writer was created with.
+// levelPools 为每个压缩级别保存一个写入器池，因为 Reset 会保留写入器创建时的压缩级别。
+type levelPools [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+
+// pool returns the pool of level, which must be between HuffmanOnly and
+// BestCompression.
+func (p *levelPools) pool(format string, level int) (*sync.Pool, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("compresspool: invalid %s compression level: %d", format, level)
+	}
+	return &p[level-flate.HuffmanOnly], nil
+}
+
+// readerPool pools the decompressors of one format. R is comparable so that
+// a wrapper can mark itself returned by setting its R to the zero value.
+// readerPool 池化一种格式的解压缩器。R 是可比较的，这样包装器就可以把自己的 R
+// 设置为零值来表示已经交还。
+type readerPool[R interface {
+	comparable
+	io.ReadCloser
+}] struct {
+	pool      sync.Pool
+	newReader func(src io.Reader) (R, error)
+	reset     func(r R, src io.Reader) error
+}
+
+func (p *readerPool[R]) get(src io.Reader) (R, error) {
+	r, ok := p.pool.Get().(R)
+	if !ok {
+		return p.newReader(src)
+	}
+	if err := p.reset(r, src); err != nil {
+		//!!! Reset 失败的读取器仍然可以再次 Reset，所以把它放回池中。
+		p.pool.Put(r)
+		var zero R
+		return zero, err
+	}
+	return r, nil
+}
+
+// put returns *r to the pool and clears it, so that putting it again does
+// nothing and misusing the wrapper panics at once instead of corrupting the
+// reader of somebody else.
+// put 把 *r 交还给池并清除它，这样再次交还什么也不做，之后误用包装器会立即 panic，
+// 而不是破坏别人正在使用的读取器。
+func (p *readerPool[R]) put(r *R) {
+	var zero R
+	if *r != zero {
+		p.pool.Put(*r)
+		*r = zero
+	}
+}
+
+func (p *readerPool[R]) close(r *R) error {
+	var zero R
+	if *r == zero {
+		return nil
+	}
+	err := (*r).Close()
+	p.put(r)
+	return err
+}
+
+// writerPool pools the compressors of one format, one pool per level.
+// writerPool 池化一种格式的压缩器，每个压缩级别一个池。
+type writerPool[W interface {
+	comparable
+	io.WriteCloser
+	Reset(dst io.Writer)
+}] struct {
+	format    string
+	levels    levelPools
+	newWriter func(dst io.Writer, level int) (W, error)
+}
+
+func (p *writerPool[W]) get(dst io.Writer, level int) (W, error) {
+	pool, err := p.levels.pool(p.format, level)
+	if err != nil {
+		var zero W
+		return zero, err
+	}
+	if w, ok := pool.Get().(W); ok {
+		w.Reset(dst)
+		return w, nil
+	}
+	return p.newWriter(dst, level)
+}
+
+// put returns *w, created at level, to the pool and clears it, discarding
+// what has not been flushed.
+// put 把以 level 级别创建的 *w 交还给池并清除它，丢弃尚未刷新的内容。
+func (p *writerPool[W]) put(w *W, level int) {
+	var zero W
+	if *w != zero {
+		(*w).Reset(io.Discard) //不再持有 dst
+		pool, _ := p.levels.pool(p.format, level)
+		pool.Put(*w)
+		*w = zero
+	}
+}
+
+func (p *writerPool[W]) close(w *W, level int) error {
+	var zero W
+	if *w == zero {
+		return nil
+	}
+	err := (*w).Close()
+	p.put(w, level)
+	return err
+}
@@ -0,0 +1,197 @@
+package compresspool
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// format 把三种格式的 Get/Put 函数统一成相同的形状，以便对它们运行同一组测试。
+type format struct {
+	name      string
+	getWriter func(dst io.Writer, level int) (io.WriteCloser, func(), error)
+	getReader func(src io.Reader) (io.ReadCloser, func(), error)
+}
+
+var formats = []format{
+	{"gzip",
+		func(dst io.Writer, level int) (io.WriteCloser, func(), error) {
+			w, err := GetGzipWriter(dst, level)
+			return w, func() { PutGzipWriter(w) }, err
+		},
+		func(src io.Reader) (io.ReadCloser, func(), error) {
+			r, err := GetGzipReader(src)
+			return r, func() { PutGzipReader(r) }, err
+		}},
+	{"zlib",
+		func(dst io.Writer, level int) (io.WriteCloser, func(), error) {
+			w, err := GetZlibWriter(dst, level)
+			return w, func() { PutZlibWriter(w) }, err
+		},
+		func(src io.Reader) (io.ReadCloser, func(), error) {
+			r, err := GetZlibReader(src)
+			return r, func() { PutZlibReader(r) }, err
+		}},
+	{"flate",
+		func(dst io.Writer, level int) (io.WriteCloser, func(), error) {
+			w, err := GetFlateWriter(dst, level)
+			return w, func() { PutFlateWriter(w) }, err
+		},
+		func(src io.Reader) (io.ReadCloser, func(), error) {
+			r, err := GetFlateReader(src)
+			return r, func() { PutFlateReader(r) }, err
+		}},
+}
+
+const cow = "how now brown cow"
+
+func (f format) compress(t *testing.T, s string, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, _, err := f.getWriter(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func (f format) decompress(t *testing.T, b []byte) string {
+	t.Helper()
+	r, _, err := f.getReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return string(got)
+}
+
+func TestRoundTripWithReuse(t *testing.T) {
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			//多次往返，池中的读取器和写入器会被 Reset 到不同的流上重用。
+			for i := range 5 {
+				for _, level := range []int{flate.HuffmanOnly, flate.DefaultCompression, flate.NoCompression, flate.BestSpeed, flate.BestCompression} {
+					s := strings.Repeat(cow, 100*i+1)
+					if got := f.decompress(t, f.compress(t, s, level)); got != s {
+						t.Fatalf("level %d: round trip of %d bytes got %d bytes", level, len(s), len(got))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestResetAfterMisuse(t *testing.T) {
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			good := f.compress(t, cow, flate.DefaultCompression)
+			for range 5 {
+				//写了一半就交还的写入器：下一次使用时必须从一个全新的流开始。
+				w, put, err := f.getWriter(io.Discard, flate.DefaultCompression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.WriteString(w, "abandoned")
+				put()
+				put()
+				if err := w.Close(); err != nil {
+					t.Errorf("Close after put: %v", err)
+				}
+
+				//读到一半就关闭的读取器，以及读取损坏数据的读取器。
+				r, _, err := f.getReader(bytes.NewReader(good))
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Read(make([]byte, 3))
+				r.Close()
+				r.Close()
+				corrupt := append([]byte(nil), good...)
+				corrupt[len(corrupt)/2] ^= 0xff
+				if r, _, err := f.getReader(bytes.NewReader(corrupt)); err == nil {
+					io.ReadAll(r)
+					r.Close()
+				}
+
+				if got := f.decompress(t, f.compress(t, cow, flate.DefaultCompression)); got != cow {
+					t.Fatalf("after misuse got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	for _, f := range formats {
+		if _, _, err := f.getWriter(io.Discard, 10); err == nil {
+			t.Errorf("%s: level 10 accepted", f.name)
+		}
+	}
+	if _, err := GetGzipReader(strings.NewReader("not gzip")); err == nil {
+		t.Error("gzip: bad header accepted")
+	}
+	if _, err := GetZlibReader(strings.NewReader("not zlib")); err == nil {
+		t.Error("zlib: bad header accepted")
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	for _, f := range formats {
+		good := f.compress(t, cow, flate.BestSpeed)
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Go(func() {
+				for range 50 {
+					if got := f.decompress(t, good); got != cow {
+						t.Errorf("%s: got %q", f.name, got)
+						return
+					}
+				}
+			})
+		}
+		wg.Wait()
+	}
+}
+
+// 与 concurrent/basic 中的 BenchmarkGunzipNopool/BenchmarkGunzipPooled 做的事情相同。
+func benchmarkGunzip(b *testing.B, get func(io.Reader) (io.ReadCloser, error)) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	io.WriteString(w, strings.Repeat(cow, 1024))
+	w.Close()
+	b.ReportAllocs()
+	for b.Loop() {
+		r, err := get(bytes.NewReader(gz.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n, err := io.Copy(io.Discard, r); err != nil || n != 1024*int64(len(cow)) {
+			b.Fatal(n, err)
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkGunzipNew(b *testing.B) {
+	benchmarkGunzip(b, func(src io.Reader) (io.ReadCloser, error) { return gzip.NewReader(src) })
+}
+
+func BenchmarkGunzipCompresspool(b *testing.B) {
+	benchmarkGunzip(b, func(src io.Reader) (io.ReadCloser, error) { return GetGzipReader(src) })
+}
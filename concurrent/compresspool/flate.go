@@ -0,0 +1,70 @@
+package compresspool
+
+import (
+	"compress/flate"
+	"io"
+)
+
+var (
+	flateReaders = readerPool[io.ReadCloser]{
+		newReader: func(src io.Reader) (io.ReadCloser, error) { return flate.NewReader(src), nil },
+		reset: func(r io.ReadCloser, src io.Reader) error {
+			return r.(flate.Resetter).Reset(src, nil)
+		},
+	}
+	flateWriters = writerPool[*flate.Writer]{format: "flate", newWriter: flate.NewWriter}
+)
+
+// A FlateReader is a pooled flate reader. Close returns it to the pool.
+// FlateReader 是一个池化的 flate 读取器。Close 会把它交还给池。
+type FlateReader struct {
+	io.ReadCloser // implements flate.Resetter 实现了 flate.Resetter
+}
+
+// GetFlateReader returns a FlateReader decompressing src. A raw DEFLATE
+// stream has no header, so errors show up on the first Read.
+// GetFlateReader 返回一个解压缩 src 的 FlateReader。原始的 DEFLATE 流没有头部，
+// 所以错误会在第一次 Read 时才出现。
+func GetFlateReader(src io.Reader) (*FlateReader, error) {
+	zr, err := flateReaders.get(src)
+	if err != nil {
+		return nil, err
+	}
+	return &FlateReader{zr}, nil
+}
+
+// PutFlateReader returns the reader of r to the pool.
+// PutFlateReader 把 r 的读取器交还给池。
+func PutFlateReader(r *FlateReader) { flateReaders.put(&r.ReadCloser) }
+
+// Close closes the flate reader and returns it to the pool.
+// Close 关闭 flate 读取器，并把它交还给池。
+func (r *FlateReader) Close() error { return flateReaders.close(&r.ReadCloser) }
+
+// A FlateWriter is a pooled flate.Writer. Close returns it to the pool.
+// FlateWriter 是一个池化的 flate.Writer。Close 会把它交还给池。
+type FlateWriter struct {
+	*flate.Writer
+	level int
+}
+
+// GetFlateWriter returns a FlateWriter compressing to dst at level, which
+// must be between flate.HuffmanOnly and flate.BestCompression.
+// GetFlateWriter 返回一个以 level 级别压缩到 dst 的 FlateWriter，level 必须在
+// flate.HuffmanOnly 与 flate.BestCompression 之间。
+func GetFlateWriter(dst io.Writer, level int) (*FlateWriter, error) {
+	zw, err := flateWriters.get(dst, level)
+	if err != nil {
+		return nil, err
+	}
+	return &FlateWriter{zw, level}, nil
+}
+
+// PutFlateWriter returns the writer of w to the pool, discarding what has
+// not been flushed.
+// PutFlateWriter 把 w 的写入器交还给池，丢弃尚未刷新的内容。
+func PutFlateWriter(w *FlateWriter) { flateWriters.put(&w.Writer, w.level) }
+
+// Close writes the rest of the flate stream and returns the writer to the pool.
+// Close 写出 flate 流剩余的部分，并把写入器交还给池。
+func (w *FlateWriter) Close() error { return flateWriters.close(&w.Writer, w.level) }
@@ -0,0 +1,67 @@
+package compresspool
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+var (
+	gzipReaders = readerPool[*gzip.Reader]{newReader: gzip.NewReader, reset: (*gzip.Reader).Reset}
+	gzipWriters = writerPool[*gzip.Writer]{format: "gzip", newWriter: gzip.NewWriterLevel}
+)
+
+// A GzipReader is a pooled gzip.Reader. Close returns it to the pool.
+// GzipReader 是一个池化的 gzip.Reader。Close 会把它交还给池。
+type GzipReader struct {
+	*gzip.Reader
+}
+
+// GetGzipReader returns a GzipReader decompressing src. Like
+// gzip.NewReader, it reads the gzip header from src and reports its errors.
+// GetGzipReader 返回一个解压缩 src 的 GzipReader。与 gzip.NewReader 一样，它会从 src 读取
+// gzip 头部并报告其中的错误。
+func GetGzipReader(src io.Reader) (*GzipReader, error) {
+	zr, err := gzipReaders.get(src)
+	if err != nil {
+		return nil, err
+	}
+	return &GzipReader{zr}, nil
+}
+
+// PutGzipReader returns the reader of r to the pool.
+// PutGzipReader 把 r 的读取器交还给池。
+func PutGzipReader(r *GzipReader) { gzipReaders.put(&r.Reader) }
+
+// Close closes the gzip.Reader and returns it to the pool. The checksum is
+// verified by Read when it reaches the end of the stream, not by Close.
+// Close 关闭 gzip.Reader，并把它交还给池。校验和是由 Read 在读到流的结尾时验证的，
+// 而不是由 Close 验证。
+func (r *GzipReader) Close() error { return gzipReaders.close(&r.Reader) }
+
+// A GzipWriter is a pooled gzip.Writer. Close returns it to the pool.
+// GzipWriter 是一个池化的 gzip.Writer。Close 会把它交还给池。
+type GzipWriter struct {
+	*gzip.Writer
+	level int
+}
+
+// GetGzipWriter returns a GzipWriter compressing to dst at level, which
+// must be between gzip.HuffmanOnly and gzip.BestCompression.
+// GetGzipWriter 返回一个以 level 级别压缩到 dst 的 GzipWriter，level 必须在
+// gzip.HuffmanOnly 与 gzip.BestCompression 之间。
+func GetGzipWriter(dst io.Writer, level int) (*GzipWriter, error) {
+	zw, err := gzipWriters.get(dst, level)
+	if err != nil {
+		return nil, err
+	}
+	return &GzipWriter{zw, level}, nil
+}
+
+// PutGzipWriter returns the writer of w to the pool, discarding what has
+// not been flushed.
+// PutGzipWriter 把 w 的写入器交还给池，丢弃尚未刷新的内容。
+func PutGzipWriter(w *GzipWriter) { gzipWriters.put(&w.Writer, w.level) }
+
+// Close writes the rest of the gzip stream and returns the writer to the pool.
+// Close 写出 gzip 流剩余的部分，并把写入器交还给池。
+func (w *GzipWriter) Close() error { return gzipWriters.close(&w.Writer, w.level) }
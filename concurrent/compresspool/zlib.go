@@ -0,0 +1,73 @@
+package compresspool
+
+import (
+	"compress/zlib"
+	"io"
+)
+
+var (
+	zlibReaders = readerPool[io.ReadCloser]{
+		newReader: zlib.NewReader,
+		reset: func(r io.ReadCloser, src io.Reader) error {
+			return r.(zlib.Resetter).Reset(src, nil)
+		},
+	}
+	zlibWriters = writerPool[*zlib.Writer]{format: "zlib", newWriter: zlib.NewWriterLevel}
+)
+
+// A ZlibReader is a pooled zlib reader. Close returns it to the pool.
+// ZlibReader 是一个池化的 zlib 读取器。Close 会把它交还给池。
+type ZlibReader struct {
+	io.ReadCloser // implements zlib.Resetter 实现了 zlib.Resetter
+}
+
+// GetZlibReader returns a ZlibReader decompressing src. Like
+// zlib.NewReader, it reads the zlib header from src and reports its errors.
+// GetZlibReader 返回一个解压缩 src 的 ZlibReader。与 zlib.NewReader 一样，它会从 src 读取
+// zlib 头部并报告其中的错误。
+func GetZlibReader(src io.Reader) (*ZlibReader, error) {
+	zr, err := zlibReaders.get(src)
+	if err != nil {
+		return nil, err
+	}
+	return &ZlibReader{zr}, nil
+}
+
+// PutZlibReader returns the reader of r to the pool.
+// PutZlibReader 把 r 的读取器交还给池。
+func PutZlibReader(r *ZlibReader) { zlibReaders.put(&r.ReadCloser) }
+
+// Close closes the zlib reader and returns it to the pool. The checksum is
+// verified by Read when it reaches the end of the stream; Close only
+// repeats an error Read already returned.
+// Close 关闭 zlib 读取器，并把它交还给池。校验和是由 Read 在读到流的结尾时验证的；
+// Close 只会重复 Read 已经返回过的错误。
+func (r *ZlibReader) Close() error { return zlibReaders.close(&r.ReadCloser) }
+
+// A ZlibWriter is a pooled zlib.Writer. Close returns it to the pool.
+// ZlibWriter 是一个池化的 zlib.Writer。Close 会把它交还给池。
+type ZlibWriter struct {
+	*zlib.Writer
+	level int
+}
+
+// GetZlibWriter returns a ZlibWriter compressing to dst at level, which
+// must be between zlib.HuffmanOnly and zlib.BestCompression.
+// GetZlibWriter 返回一个以 level 级别压缩到 dst 的 ZlibWriter，level 必须在
+// zlib.HuffmanOnly 与 zlib.BestCompression 之间。
+func GetZlibWriter(dst io.Writer, level int) (*ZlibWriter, error) {
+	zw, err := zlibWriters.get(dst, level)
+	if err != nil {
+		return nil, err
+	}
+	return &ZlibWriter{zw, level}, nil
+}
+
+// PutZlibWriter returns the writer of w to the pool, discarding what has
+// not been flushed.
+// PutZlibWriter 把 w 的写入器交还给池，丢弃尚未刷新的内容。
+func PutZlibWriter(w *ZlibWriter) { zlibWriters.put(&w.Writer, w.level) }
+
+// Close writes the rest of the zlib stream and returns the writer to the pool.
+// Close 写出 zlib 流剩余的部分，并把写入器交还给池。
+func (w *ZlibWriter) Close() error { return zlibWriters.close(&w.Writer, w.level) }
@@ -0,0 +1,265 @@
+// Package pipeline builds channel pipelines out of generic stages, like
+// gen, sq and merge in concurrent/basic/pipeline_test.go, but for any item
+// type and stopped through a context.Context instead of a done channel.
+//
+// A Pipeline is created with New. Every stage function (Source, Map,
+// Filter, FlatMap, Batch, FanOut, FanIn, FanInOrdered and Sink) starts its
+// goroutines at once and returns the channel it sends to, which the next
+// stage reads from. The first error returned by any stage cancels the
+// pipeline's context, so that every stage upstream and downstream of it
+// returns too, and Wait reports it. Every output channel must be read by
+// another stage, usually ending in a Sink, or the pipeline never finishes.
+// pipeline 包用泛型的管段（stage）组装信道管道，就像 concurrent/basic/pipeline_test.go 中的
+// gen、sq 与 merge 一样，但适用于任何类型的数据，并且通过 context.Context 而不是 done 信道来停止。
+//
+// Pipeline 由 New 创建。每个管段函数（Source、Map、Filter、FlatMap、Batch、FanOut、FanIn、
+// FanInOrdered 与 Sink）都立即启动自己的 goroutine，并返回它发送数据的信道，供下一个管段读取。
+// 任何一个管段返回的第一个错误都会取消管道的 context，使得它上游和下游的所有管段也都返回，
+// Wait 会报告这个错误。每一个输出信道都必须被另一个管段读取（通常以 Sink 结尾），否则管道永远不会结束。
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errStopped is returned inside a stage when the pipeline's context is
+// done. It only makes the stage return; it is never reported by Wait.
+var errStopped = errors.New("pipeline: stopped")
+
+// StageOptions configures a stage. A nil pointer, like the zero value,
+// means an unbuffered output channel and a name made of the stage kind and
+// its position, such as "map#2".
+// StageOptions 用于配置一个管段。nil 指针（以及零值）表示无缓冲的输出信道，以及由管段类型和
+// 位置组成的名称，例如 "map#2"。
+type StageOptions struct {
+	Name   string // reported in Metrics and errors 在 Metrics 与错误中报告的名称
+	Buffer int    // capacity of the output channels 输出信道的容量
+}
+
+func (o *StageOptions) buffer() int {
+	if o == nil || o.Buffer < 0 {
+		return 0
+	}
+	return o.Buffer
+}
+
+// A Pipeline runs stages under one context and collects their first error.
+// Pipeline 在同一个 context 下运行各个管段，并收集它们的第一个错误。
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	err     error // first error of a stage 管段的第一个错误
+	stopped bool  // a stage returned because ctx was done 有管段因为 ctx 结束而返回
+	stages  []*stage
+}
+
+// New returns an empty Pipeline whose stages stop when ctx is done.
+// New 返回一个空的 Pipeline，当 ctx 结束时它的各个管段会停止。
+func New(ctx context.Context) *Pipeline {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Pipeline{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the context the stages run under. It is canceled when a
+// stage fails.
+// Context 返回各个管段运行时使用的 context。当某个管段失败时它会被取消。
+func (p *Pipeline) Context() context.Context { return p.ctx }
+
+// Wait waits for every stage to return. It returns the first error of a
+// stage, or the cause of the parent context if it stopped the pipeline.
+// Wait 等待所有管段返回。它返回第一个管段错误；如果是父 context 停止了管道，则返回其原因。
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil && p.stopped {
+		p.err = context.Cause(p.ctx)
+	}
+	p.cancel(p.err)
+	return p.err
+}
+
+func (p *Pipeline) fail(s *stage, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == errStopped {
+		p.stopped = true
+		return
+	}
+	if p.err == nil {
+		p.err = fmt.Errorf("pipeline: %s: %w", s.name, err)
+		p.cancel(p.err) //!!! 取消 ctx，上游阻塞在发送、下游阻塞在接收的管段都会随之返回。
+	}
+}
+
+// StageMetrics reports what a stage has done so far.
+// StageMetrics 报告一个管段到目前为止所做的工作。
+type StageMetrics struct {
+	Name       string
+	Kind       string        // "source", "map", ..., "sink"
+	In, Out    int64         // items received and sent 接收与发送的数据项数量
+	Elapsed    time.Duration // since the stage started, until it returned 从管段启动到它返回（或者到现在）的时间
+	BlockedIn  time.Duration // waiting for upstream to send 等待上游发送数据的时间
+	BlockedOut time.Duration // waiting for downstream to receive 等待下游接收数据的时间
+	Done       bool
+}
+
+// Throughput returns the items received per second, or for a source the
+// items sent per second.
+// Throughput 返回每秒接收的数据项数；对于源管段，返回每秒发送的数据项数。
+func (m StageMetrics) Throughput() float64 {
+	if m.Elapsed <= 0 {
+		return 0
+	}
+	n := m.In
+	if m.Kind == "source" {
+		n = m.Out
+	}
+	return float64(n) / m.Elapsed.Seconds()
+}
+
+// Metrics returns the metrics of every stage, in the order they were added.
+// It may be called while the pipeline runs.
+// Metrics 按照管段添加的顺序返回每个管段的指标。管道运行期间也可以调用它。
+func (p *Pipeline) Metrics() []StageMetrics {
+	p.mu.Lock()
+	stages := p.stages
+	p.mu.Unlock()
+	out := make([]StageMetrics, len(stages))
+	for i, s := range stages {
+		out[i] = s.metrics()
+	}
+	return out
+}
+
+type stage struct {
+	p     *Pipeline
+	name  string
+	kind  string
+	start time.Time
+
+	running    atomic.Int64
+	end        atomic.Int64 // nanoseconds after start until the last goroutine returned
+	in, out    atomic.Int64
+	blockedIn  atomic.Int64 // nanoseconds
+	blockedOut atomic.Int64 // nanoseconds
+}
+
+// newStage registers a stage of kind. Its goroutines are started with goN.
+func (p *Pipeline) newStage(kind string, opts *StageOptions) *stage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &stage{p: p, kind: kind, start: time.Now()}
+	if opts != nil && opts.Name != "" {
+		s.name = opts.Name
+	} else {
+		s.name = fmt.Sprintf("%s#%d", kind, len(p.stages))
+	}
+	p.stages = append(p.stages, s)
+	return s
+}
+
+// goN runs f in n goroutines of s and calls done once all of them returned.
+func (s *stage) goN(n int, f func(i int) error, done func()) {
+	s.running.Add(int64(n))
+	for i := range n {
+		s.p.wg.Go(func() {
+			if err := f(i); err != nil {
+				s.p.fail(s, err)
+			}
+			//!!! end 必须在 running 减到 0 之前保存，否则并发的 Metrics 可能看到 Done 而 Elapsed 为 0。
+			s.stopped(time.Since(s.start))
+			if s.running.Add(-1) == 0 {
+				done()
+			}
+		})
+	}
+}
+
+// stopped records that a goroutine of s returned elapsed after s started,
+// keeping the latest such time in s.end.
+func (s *stage) stopped(elapsed time.Duration) {
+	for {
+		end := s.end.Load()
+		if end >= int64(elapsed) || s.end.CompareAndSwap(end, int64(elapsed)) {
+			return
+		}
+	}
+}
+
+// goStage runs f in a goroutine of s and then closes out.
+func goStage[T any](s *stage, out chan T, f func() error) {
+	s.goN(1, func(int) error { return f() }, func() { close(out) })
+}
+
+func (s *stage) metrics() StageMetrics {
+	m := StageMetrics{
+		Name:       s.name,
+		Kind:       s.kind,
+		In:         s.in.Load(),
+		Out:        s.out.Load(),
+		BlockedIn:  time.Duration(s.blockedIn.Load()),
+		BlockedOut: time.Duration(s.blockedOut.Load()),
+		Done:       s.running.Load() == 0,
+	}
+	if m.Done {
+		m.Elapsed = time.Duration(s.end.Load())
+	} else {
+		m.Elapsed = time.Since(s.start)
+	}
+	return m
+}
+
+// recv receives from in, counting the time it blocks. ok is false once in
+// is closed; err is errStopped once the pipeline's context is done.
+// recv 从 in 接收数据，并统计阻塞的时间。in 关闭后 ok 为 false；管道的 context 结束后 err 为 errStopped。
+func recv[T any](s *stage, in <-chan T) (v T, ok bool, err error) {
+	done := s.p.ctx.Done()
+	//!!! 先不阻塞地尝试一次：数据已经就绪时不必调用 time.Now。
+	select {
+	case <-done:
+		return v, false, errStopped
+	case v, ok = <-in:
+	default:
+		start := time.Now()
+		select {
+		case <-done:
+			return v, false, errStopped
+		case v, ok = <-in:
+		}
+		s.blockedIn.Add(int64(time.Since(start)))
+	}
+	if ok {
+		s.in.Add(1)
+	}
+	return v, ok, nil
+}
+
+// send sends v to out, counting the time it blocks.
+// send 把 v 发送到 out，并统计阻塞的时间。
+func send[T any](s *stage, out chan<- T, v T) error {
+	done := s.p.ctx.Done()
+	select {
+	case <-done:
+		return errStopped
+	case out <- v:
+	default:
+		start := time.Now()
+		select {
+		case <-done:
+			return errStopped
+		case out <- v:
+		}
+		s.blockedOut.Add(int64(time.Since(start)))
+	}
+	s.out.Add(1)
+	return nil
+}
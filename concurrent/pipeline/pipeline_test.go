@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func square(_ context.Context, n int) (int, error) { return n * n, nil }
+
+func collect[T any](p *Pipeline, in <-chan T) *[]T {
+	var got []T
+	Sink(p, in, func(_ context.Context, v T) error { got = append(got, v); return nil }, nil)
+	return &got
+}
+
+// 与 concurrent/basic 中的 TestSetupPipeline2 相同：gen -> sq -> merge -> print。
+func TestGenSquareMerge(t *testing.T) {
+	p := New(context.Background())
+	sq1 := Map(p, Source(p, slices.Values([]int{1, 3, 5, 7}), nil), square, nil)
+	sq2 := Map(p, Source(p, slices.Values([]int{2, 4, 6, 8}), nil), square, nil)
+	got := collect(p, FanIn(p, []<-chan int{sq1, sq2}, nil))
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(*got)
+	if want := []int{1, 4, 9, 16, 25, 36, 49, 64}; !slices.Equal(*got, want) {
+		t.Errorf("got %v, want %v", *got, want)
+	}
+}
+
+func TestFilterFlatMapBatch(t *testing.T) {
+	p := New(context.Background())
+	even := Filter(p, Source(p, slices.Values([]int{1, 2, 3, 4, 5, 6, 7}), nil),
+		func(_ context.Context, n int) (bool, error) { return n%2 == 0, nil }, nil)
+	words := FlatMap(p, even, func(_ context.Context, n int) ([]string, error) {
+		return []string{strconv.Itoa(n), strconv.Itoa(-n)}, nil
+	}, &StageOptions{Buffer: 4})
+	got := collect(p, Batch(p, words, 4, 0, nil))
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"2", "-2", "4", "-4"}, {"6", "-6"}}
+	if !slices.EqualFunc(*got, want, slices.Equal) {
+		t.Errorf("got %v, want %v", *got, want)
+	}
+}
+
+func TestBatchFlushesAfterWait(t *testing.T) {
+	p := New(context.Background())
+	in := make(chan int)
+	batches := Batch(p, in, 10, 20*time.Millisecond, nil)
+	got := collect(p, batches)
+	in <- 1
+	in <- 2
+	time.Sleep(100 * time.Millisecond) //批次还没有满，但第一个数据项已经等待得足够久了。
+	in <- 3
+	close(in)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{1, 2}, {3}}; !slices.EqualFunc(*got, want, slices.Equal) {
+		t.Errorf("got %v, want %v", *got, want)
+	}
+}
+
+func TestFanOutFanInOrdered(t *testing.T) {
+	p := New(context.Background())
+	var nums []int
+	for i := range 100 {
+		nums = append(nums, i)
+	}
+	var squared []<-chan int
+	for i, c := range FanOut(p, Source(p, slices.Values(nums), nil), 4, nil) {
+		//各个 worker 的速度不同，但输出的顺序仍然与输入相同。
+		squared = append(squared, Map(p, c, func(ctx context.Context, n int) (int, error) {
+			time.Sleep(time.Duration(i) * 100 * time.Microsecond)
+			return square(ctx, n)
+		}, nil))
+	}
+	got := collect(p, FanInOrdered(p, squared, nil))
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range *got {
+		if v != i*i {
+			t.Fatalf("item %d is %d; got %v", i, v, *got)
+		}
+	}
+	if len(*got) != 100 {
+		t.Errorf("got %d items", len(*got))
+	}
+}
+
+// forever 是一个永远不会结束的源，就像 genCancelable 在 done 关闭之前一样。
+func forever(yield func(int) bool) {
+	for i := 0; yield(i); i++ {
+	}
+}
+
+func TestErrorCancelsUpstream(t *testing.T) {
+	boom := errors.New("boom")
+	before := runtime.NumGoroutine()
+	p := New(context.Background())
+	sq := Map(p, Source(p, forever, nil), square, &StageOptions{Name: "square", Buffer: 8})
+	fail := Map(p, sq, func(_ context.Context, n int) (int, error) {
+		if n == 100 {
+			return 0, boom
+		}
+		return n, nil
+	}, &StageOptions{Name: "fail"})
+	var last int
+	Sink(p, fail, func(_ context.Context, n int) error { last = n; return nil }, nil)
+	err := p.Wait()
+	if !errors.Is(err, boom) || err.Error() != "pipeline: fail: boom" {
+		t.Fatalf("Wait = %v", err)
+	}
+	if last != 81 {
+		t.Errorf("sink got %d last, want 81", last)
+	}
+	if context.Cause(p.Context()) != err {
+		t.Errorf("context cause %v", context.Cause(p.Context()))
+	}
+	//wg.Go 的 goroutine 在 Done 之后才真正退出，稍等片刻。
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx)
+	n := 0
+	Sink(p, Source(p, forever, nil), func(context.Context, int) error {
+		if n++; n == 10 {
+			cancel()
+		}
+		return nil
+	}, nil)
+	if err := p.Wait(); err != context.Canceled {
+		t.Errorf("Wait = %v, want context.Canceled", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	p := New(context.Background())
+	src := Source(p, slices.Values([]int{1, 2, 3, 4, 5}), nil)
+	slow := Map(p, src, func(ctx context.Context, n int) (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		return n, nil
+	}, &StageOptions{Name: "slow"})
+	collect(p, slow)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	m := p.Metrics()
+	if len(m) != 3 || m[0].Name != "source#0" || m[1].Name != "slow" || m[2].Kind != "sink" {
+		t.Fatalf("metrics %+v", m)
+	}
+	for _, s := range m {
+		if !s.Done || s.Throughput() <= 0 {
+			t.Errorf("%s: %+v, throughput %f", s.Name, s, s.Throughput())
+		}
+	}
+	//源等待慢的 Map 接收，汇（sink）等待它发送。
+	if m[0].Out != 5 || m[1].In != 5 || m[1].Out != 5 || m[2].In != 5 {
+		t.Errorf("counts %+v", m)
+	}
+	if m[0].BlockedOut < 30*time.Millisecond || m[2].BlockedIn < 30*time.Millisecond {
+		t.Errorf("source blocked %v, sink blocked %v", m[0].BlockedOut, m[2].BlockedIn)
+	}
+}
+
+// TestStageStoppedKeepsLatest：管段的 goroutine 可能乱序记录结束时间，end 应该保留最晚的那个。
+func TestStageStoppedKeepsLatest(t *testing.T) {
+	var s stage
+	for _, d := range []time.Duration{2, 5, 3} {
+		s.stopped(d)
+	}
+	if end := time.Duration(s.end.Load()); end != 5 {
+		t.Errorf("end = %v, want 5ns", end)
+	}
+}
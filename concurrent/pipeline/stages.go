@@ -0,0 +1,267 @@
+package pipeline
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// Source sends the items of seq, like gen.
+// Source 发送 seq 中的数据项，就像 gen 一样。
+func Source[T any](p *Pipeline, seq iter.Seq[T], opts *StageOptions) <-chan T {
+	s := p.newStage("source", opts)
+	out := make(chan T, opts.buffer())
+	goStage(s, out, func() error {
+		for v := range seq {
+			if err := send(s, out, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+// Map sends f of every item of in, like sq.
+// Map 发送 in 中每个数据项经过 f 的结果，就像 sq 一样。
+func Map[T, U any](p *Pipeline, in <-chan T, f func(context.Context, T) (U, error), opts *StageOptions) <-chan U {
+	s := p.newStage("map", opts)
+	out := make(chan U, opts.buffer())
+	goStage(s, out, func() error {
+		for {
+			v, ok, err := recv(s, in)
+			if !ok {
+				return err
+			}
+			u, err := f(p.ctx, v)
+			if err != nil {
+				return err
+			}
+			if err := send(s, out, u); err != nil {
+				return err
+			}
+		}
+	})
+	return out
+}
+
+// Filter sends the items of in for which f returns true.
+// Filter 发送 in 中使 f 返回 true 的数据项。
+func Filter[T any](p *Pipeline, in <-chan T, f func(context.Context, T) (bool, error), opts *StageOptions) <-chan T {
+	s := p.newStage("filter", opts)
+	out := make(chan T, opts.buffer())
+	goStage(s, out, func() error {
+		for {
+			v, ok, err := recv(s, in)
+			if !ok {
+				return err
+			}
+			keep, err := f(p.ctx, v)
+			if err != nil {
+				return err
+			}
+			if !keep {
+				continue
+			}
+			if err := send(s, out, v); err != nil {
+				return err
+			}
+		}
+	})
+	return out
+}
+
+// FlatMap sends every item of f of every item of in.
+// FlatMap 发送 in 中每个数据项经过 f 得到的所有数据项。
+func FlatMap[T, U any](p *Pipeline, in <-chan T, f func(context.Context, T) ([]U, error), opts *StageOptions) <-chan U {
+	s := p.newStage("flatmap", opts)
+	out := make(chan U, opts.buffer())
+	goStage(s, out, func() error {
+		for {
+			v, ok, err := recv(s, in)
+			if !ok {
+				return err
+			}
+			us, err := f(p.ctx, v)
+			if err != nil {
+				return err
+			}
+			for _, u := range us {
+				if err := send(s, out, u); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	return out
+}
+
+// Batch groups the items of in into slices of size items. The last batch
+// may be shorter. If wait > 0, a batch is also sent once its first item has
+// waited that long.
+// Batch 把 in 中的数据项按 size 个一组分批发送，最后一批可能不足 size 个。如果 wait > 0，
+// 一批中的第一个数据项等待了这么长时间之后，这一批也会被发送。
+func Batch[T any](p *Pipeline, in <-chan T, size int, wait time.Duration, opts *StageOptions) <-chan []T {
+	size = max(size, 1)
+	s := p.newStage("batch", opts)
+	out := make(chan []T, opts.buffer())
+	goStage(s, out, func() error {
+		var batch []T
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		flush := func() error {
+			if timer != nil {
+				timer.Stop()
+				timeout = nil
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			b := batch
+			batch = nil
+			return send(s, out, b)
+		}
+		for {
+			//!!! 有了计时器之后，接收数据时还要同时等待它，所以不能使用 recv。
+			start := time.Now()
+			select {
+			case <-p.ctx.Done():
+				return errStopped
+			case <-timeout:
+				s.blockedIn.Add(int64(time.Since(start)))
+				if err := flush(); err != nil {
+					return err
+				}
+				continue
+			case v, ok := <-in:
+				s.blockedIn.Add(int64(time.Since(start)))
+				if !ok {
+					return flush()
+				}
+				s.in.Add(1)
+				batch = append(batch, v)
+			}
+			switch {
+			case len(batch) == size:
+				if err := flush(); err != nil {
+					return err
+				}
+			case len(batch) == 1 && wait > 0:
+				if timer == nil {
+					timer = time.NewTimer(wait)
+				} else {
+					timer.Reset(wait)
+				}
+				timeout = timer.C
+			}
+		}
+	})
+	return out
+}
+
+// FanOut sends the items of in to n channels in turn, so that n copies of
+// the next stage share the work. FanInOrdered puts them back in order.
+// FanOut 把 in 中的数据项轮流发送到 n 个信道，使得下一个管段的 n 个副本可以分担工作。
+// FanInOrdered 可以把它们恢复成原来的顺序。
+func FanOut[T any](p *Pipeline, in <-chan T, n int, opts *StageOptions) []<-chan T {
+	n = max(n, 1)
+	s := p.newStage("fanout", opts)
+	outs := make([]chan T, n)
+	ros := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T, opts.buffer())
+		ros[i] = outs[i]
+	}
+	s.goN(1, func(int) error {
+		for i := 0; ; i = (i + 1) % n {
+			v, ok, err := recv(s, in)
+			if !ok {
+				return err
+			}
+			if err := send(s, outs[i], v); err != nil {
+				return err
+			}
+		}
+	}, func() {
+		for _, out := range outs {
+			close(out)
+		}
+	})
+	return ros
+}
+
+// FanIn sends the items of every channel in ins as they arrive, like merge.
+// FanIn 按照到达的先后发送 ins 中每个信道的数据项，就像 merge 一样。
+func FanIn[T any](p *Pipeline, ins []<-chan T, opts *StageOptions) <-chan T {
+	s := p.newStage("fanin", opts)
+	out := make(chan T, opts.buffer())
+	if len(ins) == 0 {
+		close(out)
+		return out
+	}
+	//为每一个输入信道开启一个 goroutine，最后一个返回的 goroutine 关闭 out。
+	s.goN(len(ins), func(i int) error {
+		for {
+			v, ok, err := recv(s, ins[i])
+			if !ok {
+				return err
+			}
+			if err := send(s, out, v); err != nil {
+				return err
+			}
+		}
+	}, func() { close(out) })
+	return out
+}
+
+// FanInOrdered receives from the channels of ins in turn, undoing FanOut:
+// if every channel carries the output of a stage that sends one item per
+// item received, such as Map, the items come out in the order FanOut
+// received them. Once a channel is closed it is skipped.
+// FanInOrdered 轮流从 ins 中的信道接收数据，与 FanOut 的作用相反：如果每个信道传递的都是
+// 每接收一个数据项就发送一个数据项的管段（例如 Map）的输出，数据项就会按照 FanOut 接收它们的
+// 顺序输出。关闭的信道会被跳过。
+func FanInOrdered[T any](p *Pipeline, ins []<-chan T, opts *StageOptions) <-chan T {
+	s := p.newStage("fanin-ordered", opts)
+	out := make(chan T, opts.buffer())
+	open := append([]<-chan T(nil), ins...)
+	goStage(s, out, func() error {
+		for i := 0; len(open) > 0; {
+			v, ok, err := recv(s, open[i])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				open = append(open[:i], open[i+1:]...)
+			} else {
+				if err := send(s, out, v); err != nil {
+					return err
+				}
+				i++
+			}
+			if i >= len(open) {
+				i = 0
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+// Sink calls f for every item of in, like printNum. Call Wait to wait for
+// it to finish.
+// Sink 对 in 中的每一个数据项调用 f，就像 printNum 一样。调用 Wait 等待它结束。
+func Sink[T any](p *Pipeline, in <-chan T, f func(context.Context, T) error, opts *StageOptions) {
+	s := p.newStage("sink", opts)
+	s.goN(1, func(int) error {
+		for {
+			v, ok, err := recv(s, in)
+			if !ok {
+				return err
+			}
+			if err := f(p.ctx, v); err != nil {
+				return err
+			}
+		}
+	}, func() {})
+}
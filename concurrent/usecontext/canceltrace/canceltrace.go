@@ -0,0 +1,168 @@
+// Package canceltrace records why the contexts of a request were canceled.
+// Each context of the request tree is a named scope created with WithCancel
+// or WithTimeout; when its owner cancels it, the scope's cancel cause (see
+// context.Cause) is appended to the Trace carried by the request context.
+// canceltrace 包记录一个请求中的各个 context 为何被取消。请求树中的每个 context 都是
+// 用 WithCancel 或 WithTimeout 创建的具名作用域；当它的所有者取消它时，该作用域的
+// 取消原因（参见 context.Cause）就被追加到请求 context 所携带的 Trace 中。
+package canceltrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Causes of cancellation that are not errors of the work itself.
+// 并非工作本身出错的取消原因。
+var (
+	// ErrReturned is the cause of a context canceled because the function
+	// that owns it, such as an HTTP handler, returned.
+	// ErrReturned 是因为拥有 context 的函数（例如 HTTP 处理器）返回了而取消 context 的原因。
+	ErrReturned = errors.New("returned")
+	// ErrClientDisconnected is the cause of a request canceled because the client went away.
+	// ErrClientDisconnected 是因为客户端离开而取消请求的原因。
+	ErrClientDisconnected = errors.New("client disconnected")
+	// ErrServerShutdown is the cause of a request canceled because the server is shutting down.
+	// ErrServerShutdown 是因为服务器正在关闭而取消请求的原因。
+	ErrServerShutdown = errors.New("server shutting down")
+)
+
+// TimeoutError is the cause of a context whose timeout expired. It matches
+// context.DeadlineExceeded with errors.Is.
+// TimeoutError 是超时到期的 context 的取消原因，用 errors.Is 可以与 context.DeadlineExceeded 匹配。
+type TimeoutError struct {
+	Name    string // the scope that set the timeout 设置超时的作用域
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout of %v expired", e.Name, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// UpstreamError is the cause of a context canceled because an upstream failed.
+// UpstreamError 是因为上游失败而取消 context 的原因。
+type UpstreamError struct {
+	Name string // the failing upstream, if known 失败的上游（如果知道）
+	Err  error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Name == "" {
+		return "upstream failure: " + e.Err.Error()
+	}
+	return fmt.Sprintf("upstream %s failure: %v", e.Name, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+// An Event records the cancellation of one scope.
+// Event 记录一个作用域的取消。
+type Event struct {
+	Name  string
+	Cause error
+	// At is when the cancellation was recorded, relative to the start of the Trace.
+	// At 是记录这次取消的时间，相对于 Trace 的开始时间。
+	At time.Duration
+}
+
+func (ev Event) String() string {
+	return fmt.Sprintf("%s: %v after %v", ev.Name, ev.Cause, ev.At.Round(time.Millisecond))
+}
+
+// A Trace collects the cancellation Events of one request. It is safe for
+// concurrent use.
+// Trace 收集一个请求的所有取消事件（Event），可以被并发使用。
+type Trace struct {
+	start  time.Time
+	mu     sync.Mutex
+	events []Event
+}
+
+// New returns an empty Trace starting now.
+// New 返回一个从现在开始的空 Trace。
+func New() *Trace { return &Trace{start: time.Now()} }
+
+// Events returns the events recorded so far, in order.
+// Events 按顺序返回到目前为止记录的事件。
+func (t *Trace) Events() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Event(nil), t.events...)
+}
+
+// String joins the events with "; ".
+// String 用 "; " 连接所有事件。
+func (t *Trace) String() string {
+	events := t.Events()
+	s := make([]string, len(events))
+	for i, ev := range events {
+		s[i] = ev.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+func (t *Trace) record(name string, cause error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, Event{Name: name, Cause: cause, At: time.Since(t.start)})
+}
+
+type traceKey struct{}
+
+// NewContext returns a copy of ctx that carries t.
+// NewContext 返回携带 t 的 ctx 的一个副本。
+func NewContext(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// FromContext returns the Trace carried by ctx, or nil.
+// FromContext 返回 ctx 所携带的 Trace，没有时返回 nil。
+func FromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// WithCancel returns a child scope of parent named name. Calling cancel
+// cancels it with cause (nil means context.Canceled) and records the scope's
+// actual cause in the Trace of parent, if any; that is the parent's cause
+// when the parent was canceled first. The first call records, later calls
+// do nothing.
+// WithCancel 返回 parent 的一个名为 name 的子作用域。调用 cancel 以 cause（nil 表示
+// context.Canceled）取消它，并把该作用域实际的取消原因记录到 parent 的 Trace 中（如果有）；
+// 父作用域先被取消时，实际原因就是父作用域的原因。第一次调用会记录，之后的调用什么也不做。
+func WithCancel(parent context.Context, name string) (ctx context.Context, cancel context.CancelCauseFunc) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	return ctx, recorder(ctx, name, cancelCause, nil)
+}
+
+// WithTimeout is like WithCancel, but the scope is also canceled with a
+// *TimeoutError once timeout elapses.
+// WithTimeout 与 WithCancel 类似，但在 timeout 到期时该作用域还会以 *TimeoutError 被取消。
+func WithTimeout(parent context.Context, name string, timeout time.Duration) (ctx context.Context, cancel context.CancelCauseFunc) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	ctx, stop := context.WithTimeoutCause(ctx, timeout, &TimeoutError{Name: name, Timeout: timeout})
+	return ctx, recorder(ctx, name, cancelCause, stop)
+}
+
+// recorder returns the cancel function of the scope ctx.
+func recorder(ctx context.Context, name string, cancel context.CancelCauseFunc, stop context.CancelFunc) context.CancelCauseFunc {
+	t := FromContext(ctx)
+	var once sync.Once
+	return func(cause error) {
+		cancel(cause)
+		if stop != nil {
+			stop()
+		}
+		once.Do(func() {
+			if t != nil {
+				t.record(name, context.Cause(ctx))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package canceltrace
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopesRecordTheirCauses(t *testing.T) {
+	trace := New()
+	root, cancelRoot := WithCancel(NewContext(context.Background(), trace), "request")
+	search, cancelSearch := WithTimeout(root, "search", 10*time.Millisecond)
+	source, cancelSource := WithCancel(search, "source a")
+	failing, cancelFailing := WithCancel(search, "source b")
+
+	errBoom := errors.New("boom")
+	cancelFailing(&UpstreamError{Name: "b", Err: errBoom})
+	<-source.Done()
+	cancelSource(ErrReturned) //父作用域先被取消，记录的是父作用域的原因
+	cancelSearch(ErrReturned)
+	cancelSearch(errBoom) //只有第一次调用会记录
+	cancelRoot(ErrReturned)
+
+	events := trace.Events()
+	if len(events) != 4 {
+		t.Fatalf("events = %v", events)
+	}
+	var timeout *TimeoutError
+	var upstream *UpstreamError
+	if events[0].Name != "source b" || !errors.As(events[0].Cause, &upstream) || upstream.Err != errBoom {
+		t.Errorf("event 0 = %v", events[0])
+	}
+	for _, ev := range events[1:3] {
+		if !errors.As(ev.Cause, &timeout) || timeout.Name != "search" || !errors.Is(ev.Cause, context.DeadlineExceeded) {
+			t.Errorf("%s: cause %v, want the search timeout", ev.Name, ev.Cause)
+		}
+	}
+	if events[3].Name != "request" || events[3].Cause != ErrReturned {
+		t.Errorf("event 3 = %v", events[3])
+	}
+	if context.Cause(failing).Error() != "upstream b failure: boom" {
+		t.Errorf("Cause = %v", context.Cause(failing))
+	}
+	if s := trace.String(); !strings.HasPrefix(s, "source b: upstream b failure: boom after ") || strings.Count(s, "; ") != 3 {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestScopesWithoutTrace(t *testing.T) {
+	ctx, cancel := WithCancel(context.Background(), "x")
+	cancel(nil)
+	if FromContext(ctx) != nil || context.Cause(ctx) != context.Canceled {
+		t.Errorf("trace %v, cause %v", FromContext(ctx), context.Cause(ctx))
+	}
+}
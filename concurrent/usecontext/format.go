@@ -0,0 +1,195 @@
+package usecontext
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/google"
+)
+
+// format is the representation of a /search response.
+// format 是 /search 响应的表现形式。
+type format int
+
+const (
+	formatHTML   format = iota // text/html, rendered by resultsTemplate
+	formatJSON                 // application/json, one document with results and metadata
+	formatNDJSON               // application/x-ndjson, one line per result as soon as it is found
+)
+
+// negotiateFormat picks the response format from the format= query param
+// (html, json or ndjson) or, failing that, from the Accept header.
+// negotiateFormat 根据查询参数 format=（html、json 或 ndjson）确定响应格式，
+// 如果没有该参数，则根据 Accept 头部确定。
+func negotiateFormat(req *http.Request) format {
+	switch strings.ToLower(req.FormValue("format")) {
+	case "json":
+		return formatJSON
+	case "ndjson":
+		return formatNDJSON
+	case "html":
+		return formatHTML
+	}
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/x-ndjson":
+			return formatNDJSON
+		case "application/json":
+			return formatJSON
+		case "text/html":
+			return formatHTML
+		}
+	}
+	return formatHTML
+}
+
+// searchResponse is the application/json body of a successful search.
+// searchResponse 是一次成功搜索的 application/json 响应体。
+type searchResponse struct {
+	Query   string         `json:"query"`
+	Results google.Results `json:"results"`
+	searchSummary
+}
+
+// searchSummary is the metadata of a search; it is also the last line of an
+// NDJSON stream.
+// searchSummary 是一次搜索的元数据，它也是 NDJSON 流的最后一行。
+type searchSummary struct {
+	Sources   []sourceJSON `json:"sources"`
+	ElapsedMS float64      `json:"elapsed_ms"`
+	TimeoutMS float64      `json:"timeout_ms,omitempty"` //0表示请求没有设置超时
+}
+
+type sourceJSON struct {
+	Name      string        `json:"name"`
+	Status    google.Status `json:"status"`
+	Results   int           `json:"results"`
+	ElapsedMS float64       `json:"elapsed_ms"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func newSearchSummary(sources []google.SourceReport, elapsed, timeout time.Duration) searchSummary {
+	s := searchSummary{
+		Sources:   make([]sourceJSON, len(sources)),
+		ElapsedMS: millis(elapsed),
+		TimeoutMS: millis(timeout),
+	}
+	for i, r := range sources {
+		s.Sources[i] = sourceJSON{Name: r.Name, Status: r.Status, Results: r.Results, ElapsedMS: millis(r.Elapsed)}
+		if r.Err != nil {
+			s.Sources[i].Error = r.Err.Error()
+		}
+	}
+	return s
+}
+
+// errorBody is the JSON error returned instead of http.Error's plain text.
+// errorBody 是代替 http.Error 纯文本而返回的 JSON 错误。
+type errorBody struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+		// Cause and Trace tell why a failed search was canceled.
+		// Cause 与 Trace 说明失败的搜索为何被取消。
+		Cause string   `json:"cause,omitempty"`
+		Trace []string `json:"trace,omitempty"`
+	} `json:"error"`
+}
+
+// writeError reports err with the given status code in the negotiated format.
+// writeError 以协商好的格式报告 err 及给定的状态码。
+func writeError(w http.ResponseWriter, f format, code int, err error) {
+	if f == formatHTML {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	contentType := "application/json"
+	if f == formatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(newErrorBody(code, err)); err != nil {
+		log.Print(err)
+	}
+}
+
+// writeRequestError is writeError in the format negotiated for req, for the
+// WriteError hooks of the middlewares.
+// writeRequestError 是以为 req 协商的格式调用的 writeError，供各个中间件的 WriteError 使用。
+func writeRequestError(w http.ResponseWriter, req *http.Request, code int, err error) {
+	writeError(w, negotiateFormat(req), code, err)
+}
+
+// newErrorBody describes err, with the cancellation cause and trace of a failed search.
+// newErrorBody 描述 err，对于失败的搜索还附带取消原因与取消跟踪。
+func newErrorBody(code int, err error) errorBody {
+	var body errorBody
+	body.Error.Status = code
+	body.Error.Message = err.Error()
+	var failure *searchFailure
+	if errors.As(err, &failure) {
+		body.Error.Message = failure.err.Error()
+		if failure.cause != nil {
+			body.Error.Cause = failure.cause.Error()
+		}
+		for _, ev := range failure.trace {
+			body.Error.Trace = append(body.Error.Trace, ev.String())
+		}
+	}
+	return body
+}
+
+// streamLine is one line of an application/x-ndjson response: a result, the
+// closing summary, or an error that happened after streaming had begun.
+// streamLine 是 application/x-ndjson 响应中的一行：一个结果、结尾的摘要，
+// 或者在开始流式输出之后发生的错误。
+type streamLine struct {
+	Result  *google.Result `json:"result,omitempty"`
+	Summary *searchSummary `json:"summary,omitempty"`
+	Error   *string        `json:"error,omitempty"`
+}
+
+// ndjsonWriter writes one JSON value per line and flushes it to the client at once.
+// ndjsonWriter 每行写一个 JSON 值，并立即把它刷新（flush）到客户端。
+type ndjsonWriter struct {
+	w   http.ResponseWriter
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	return &ndjsonWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (nw *ndjsonWriter) write(line streamLine) {
+	if err := nw.enc.Encode(line); err != nil {
+		log.Print(err)
+		return
+	}
+	if f, ok := nw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,21 @@
+package google
+
+import "context"
+
+// A Backend answers search queries. Implementations must honor ctx: when
+// ctx.Done is closed they should stop working and return ctx.Err().
+// Backend 负责回答搜索查询。实现者必须遵守 ctx 的约定：当 ctx.Done 关闭时，
+// 应当停止工作并返回 ctx.Err()。
+type Backend interface {
+	Search(ctx context.Context, query string) (Results, error)
+}
+
+// BackendFunc adapts an ordinary function to the Backend interface,
+// for example BackendFunc(Search).
+// BackendFunc 把普通函数适配为 Backend 接口，例如 BackendFunc(Search)。
+type BackendFunc func(ctx context.Context, query string) (Results, error)
+
+// Search calls f(ctx, query).
+func (f BackendFunc) Search(ctx context.Context, query string) (Results, error) {
+	return f(ctx, query)
+}
@@ -0,0 +1,246 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit Breaker.
+// BreakerState 是熔断器（circuit breaker）的状态。
+type BreakerState int
+
+const (
+	// StateClosed lets every call through and counts consecutive failures.
+	// StateClosed 放行所有调用，并统计连续失败的次数。
+	StateClosed BreakerState = iota
+	// StateOpen rejects every call at once until the cool-down has passed.
+	// StateOpen 立即拒绝所有调用，直到冷却时间过去。
+	StateOpen
+	// StateHalfOpen lets a limited number of trial calls through to probe the backend.
+	// StateHalfOpen 放行有限数量的试探调用来探测后端。
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// ErrBreakerOpen is matched (with errors.Is) by the errors a Breaker returns
+// without calling its backend.
+// Breaker 在不调用后端的情况下所返回的错误都能（用 errors.Is）与 ErrBreakerOpen 匹配。
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerOpenError is returned while a Breaker rejects calls.
+// BreakerOpenError 是 Breaker 拒绝调用时返回的错误。
+type BreakerOpenError struct {
+	Name       string
+	RetryAfter time.Duration // time left until the next trial call 距离下一次试探调用的剩余时间
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("google: %s: %v, retry after %v", e.Name, ErrBreakerOpen, e.RetryAfter)
+}
+
+func (e *BreakerOpenError) Is(target error) bool { return target == ErrBreakerOpen }
+
+// A BreakerEvent reports a state change of a Breaker.
+// BreakerEvent 报告 Breaker 的一次状态变化。
+type BreakerEvent struct {
+	Name     string
+	From, To BreakerState
+	At       time.Time
+	Err      error // the failure that caused the change, if any 引起这次变化的失败（如果有）
+}
+
+// A Breaker is a Backend that stops calling a failing backend for a while.
+// After FailureThreshold consecutive failures it opens and fails fast with a
+// BreakerOpenError; after CoolDown it lets HalfOpenMax trial calls through,
+// closing again when all of them succeed and reopening on the first failure.
+// A Breaker must not be copied after first use.
+// Breaker 是一个在后端持续失败时暂停调用它一段时间的 Backend。连续失败 FailureThreshold
+// 次后它就打开（open），并以 BreakerOpenError 快速失败；经过 CoolDown 之后，它放行
+// HalfOpenMax 个试探调用，全部成功时再次闭合，第一次失败时重新打开。
+// Breaker 第一次使用后不能被拷贝。
+type Breaker struct {
+	Name    string
+	Backend Backend
+
+	FailureThreshold int           // 0 means 5 ，0 表示 5
+	CoolDown         time.Duration // 0 means 30s，0 表示 30 秒
+	HalfOpenMax      int           // 0 means 1 ，0 表示 1
+
+	// IsFailure reports whether an error of the backend counts against it;
+	// nil means every error returned while the caller's ctx is not done, so
+	// that neither the caller's cancellation nor its deadline count.
+	// IsFailure 报告后端的某个错误是否计为失败；nil 表示调用者的 ctx 尚未结束时返回的
+	// 所有错误，因此调用者的取消与截止时间都不计为失败。
+	IsFailure func(ctx context.Context, err error) bool
+	// OnStateChange, if set, is called after every state change, outside the breaker's lock.
+	// OnStateChange 如果不为空，则在每次状态变化之后被调用，调用时不持有熔断器的锁。
+	OnStateChange func(BreakerEvent)
+	// Now returns the current time; nil means time.Now.
+	// Now 返回当前时间，nil 表示 time.Now。
+	Now func() time.Time
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int       // consecutive failures while closed 闭合状态下的连续失败次数
+	trials    int       // trial calls admitted while half-open 半开状态下已放行的试探调用数
+	successes int       // trial calls that succeeded 成功的试探调用数
+	openedAt  time.Time // when the breaker last opened 最近一次打开的时间
+}
+
+var _ Backend = (*Breaker)(nil)
+
+// NewBreaker returns a Breaker with default settings around backend.
+// NewBreaker 返回一个包装了 backend、使用默认设置的 Breaker。
+func NewBreaker(name string, backend Backend) *Breaker {
+	return &Breaker{Name: name, Backend: backend}
+}
+
+// State returns the current state of the breaker.
+// State 返回熔断器的当前状态。
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Search calls the backend unless the breaker is open.
+// Search 调用后端，除非熔断器处于打开状态。
+func (b *Breaker) Search(ctx context.Context, query string) (Results, error) {
+	if err := b.admit(); err != nil {
+		return nil, err
+	}
+	results, err := b.Backend.Search(ctx, query)
+	b.record(ctx, err)
+	return results, err
+}
+
+// admit decides whether a call may go through, moving from open to half-open
+// when the cool-down has passed.
+func (b *Breaker) admit() error {
+	now := b.now()
+	b.mu.Lock()
+	var events []BreakerEvent
+	defer func() {
+		b.mu.Unlock()
+		b.emit(events)
+	}()
+	if b.state == StateOpen {
+		if wait := b.openedAt.Add(b.coolDown()).Sub(now); wait > 0 {
+			return &BreakerOpenError{Name: b.Name, RetryAfter: wait}
+		}
+		events = append(events, b.setState(StateHalfOpen, now, nil))
+	}
+	if b.state == StateHalfOpen {
+		if b.trials >= b.halfOpenMax() {
+			//试探调用的名额已用完，在它们有结果之前继续快速失败。
+			return &BreakerOpenError{Name: b.Name, RetryAfter: b.coolDown()}
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// record counts the outcome of a call that admit let through.
+func (b *Breaker) record(ctx context.Context, err error) {
+	now := b.now()
+	failed := err != nil
+	if failed && b.IsFailure != nil {
+		failed = b.IsFailure(ctx, err)
+	} else if failed {
+		//!!! 调用者自己的 ctx 已经结束（被取消或者超过了截止时间），这不是后端的过错。
+		//!!! 否则任何客户端都可以用 timeout=1ms 的请求为所有人打开熔断器。
+		failed = ctx.Err() == nil
+	}
+	b.mu.Lock()
+	var events []BreakerEvent
+	defer func() {
+		b.mu.Unlock()
+		b.emit(events)
+	}()
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		if b.failures++; b.failures >= b.failureThreshold() {
+			events = append(events, b.setState(StateOpen, now, err))
+		}
+	case StateHalfOpen:
+		if failed {
+			events = append(events, b.setState(StateOpen, now, err))
+			return
+		}
+		if err != nil {
+			//不计为失败的错误也不算成功：归还试探名额。
+			b.trials--
+			return
+		}
+		if b.successes++; b.successes >= b.halfOpenMax() {
+			events = append(events, b.setState(StateClosed, now, nil))
+		}
+	}
+	//StateOpen：打开之前就已放行的调用，其结果不再影响状态。
+}
+
+// setState moves to state to and resets the counters; b.mu must be held.
+func (b *Breaker) setState(to BreakerState, now time.Time, err error) BreakerEvent {
+	ev := BreakerEvent{Name: b.Name, From: b.state, To: to, At: now, Err: err}
+	b.state = to
+	b.failures, b.trials, b.successes = 0, 0, 0
+	if to == StateOpen {
+		b.openedAt = now
+	}
+	return ev
+}
+
+func (b *Breaker) emit(events []BreakerEvent) {
+	if b.OnStateChange == nil {
+		return
+	}
+	for _, ev := range events {
+		b.OnStateChange(ev)
+	}
+}
+
+func (b *Breaker) failureThreshold() int {
+	if b.FailureThreshold > 0 {
+		return b.FailureThreshold
+	}
+	return 5
+}
+
+func (b *Breaker) coolDown() time.Duration {
+	if b.CoolDown > 0 {
+		return b.CoolDown
+	}
+	return 30 * time.Second
+}
+
+func (b *Breaker) halfOpenMax() int {
+	if b.HalfOpenMax > 0 {
+		return b.HalfOpenMax
+	}
+	return 1
+}
+
+func (b *Breaker) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
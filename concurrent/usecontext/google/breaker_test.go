@@ -0,0 +1,120 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	now := time.Unix(0, 0)
+	fail := true
+	var calls int
+	backend := BackendFunc(func(context.Context, string) (Results, error) {
+		calls++
+		if fail {
+			return nil, errors.New("upstream down")
+		}
+		return Results{{Title: "ok"}}, nil
+	})
+	var events []BreakerEvent
+	b := &Breaker{
+		Name: "test", Backend: backend,
+		FailureThreshold: 2, CoolDown: time.Second,
+		Now:           func() time.Time { return now },
+		OnStateChange: func(ev BreakerEvent) { events = append(events, ev) },
+	}
+	ctx := context.Background()
+	b.Search(ctx, "q")
+	b.Search(ctx, "q")
+	if b.State() != StateOpen {
+		t.Fatalf("state after 2 failures = %s, want open", b.State())
+	}
+	_, err := b.Search(ctx, "q")
+	var open *BreakerOpenError
+	if !errors.Is(err, ErrBreakerOpen) || !errors.As(err, &open) || open.RetryAfter != time.Second || calls != 2 {
+		t.Fatalf("open breaker: err = %v after %d calls", err, calls)
+	}
+
+	now = now.Add(time.Second)
+	fail = false
+	if _, err := b.Search(ctx, "q"); err != nil || b.State() != StateClosed {
+		t.Fatalf("trial call: err = %v, state = %s", err, b.State())
+	}
+	want := []BreakerState{StateOpen, StateHalfOpen, StateClosed}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v", events)
+	}
+	for i, ev := range events {
+		if ev.To != want[i] {
+			t.Errorf("event %d: -> %s, want %s", i, ev.To, want[i])
+		}
+	}
+	if events[0].Err == nil {
+		t.Error("the opening event should carry the failure")
+	}
+}
+
+func TestBreakerHalfOpenLimitsTrials(t *testing.T) {
+	now := time.Unix(0, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fail := true
+	b := &Breaker{
+		Name:             "test",
+		FailureThreshold: 1, CoolDown: time.Second, HalfOpenMax: 1,
+		Now: func() time.Time { return now },
+		Backend: BackendFunc(func(context.Context, string) (Results, error) {
+			if fail {
+				return nil, errors.New("down")
+			}
+			started <- struct{}{}
+			<-release
+			return nil, nil
+		}),
+	}
+	b.Search(context.Background(), "q")
+	now = now.Add(time.Second)
+	fail = false
+	done := make(chan struct{})
+	go func() {
+		b.Search(context.Background(), "q")
+		close(done)
+	}()
+	<-started
+	//唯一的试探名额正在使用中，第二个调用必须快速失败。
+	if _, err := b.Search(context.Background(), "q"); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("second trial: err = %v, want ErrBreakerOpen", err)
+	}
+	close(release)
+	<-done
+	if b.State() != StateClosed {
+		t.Errorf("state = %s, want closed", b.State())
+	}
+}
+
+func TestBreakerIgnoresCallerCancellation(t *testing.T) {
+	b := &Breaker{Name: "test", FailureThreshold: 1, Backend: slowBackend(time.Minute)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Search(ctx, "q")
+	if b.State() != StateClosed {
+		t.Errorf("state = %s after the caller canceled, want closed", b.State())
+	}
+}
+
+func TestBreakerIgnoresCallerDeadline(t *testing.T) {
+	b := &Breaker{Name: "test", FailureThreshold: 1, Backend: slowBackend(time.Minute)}
+	//截止时间在慢的后端调用进行中到达，就像客户端发送了 timeout=1ms 一样。
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		if _, err := b.Search(ctx, "q"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Search = %v, want deadline exceeded", err)
+		}
+		cancel()
+	}
+	if b.State() != StateClosed {
+		t.Errorf("state = %s after the caller's deadlines expired, want closed", b.State())
+	}
+}
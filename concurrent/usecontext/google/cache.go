@@ -0,0 +1,247 @@
+package google
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheMode tells a Cache how to treat one search, usually following the
+// Cache-Control header of the request.
+// CacheMode 告诉 Cache 如何对待一次搜索，通常取决于请求的 Cache-Control 头部。
+type CacheMode int
+
+const (
+	// CacheDefault answers from the cache when it can. 尽可能从缓存中回答。
+	CacheDefault CacheMode = iota
+	// CacheNoCache skips the lookup but stores the fresh results (Cache-Control: no-cache).
+	// CacheNoCache 跳过查找，但存储新的结果（Cache-Control: no-cache）。
+	CacheNoCache
+	// CacheNoStore bypasses the cache completely (Cache-Control: no-store).
+	// CacheNoStore 完全绕过缓存（Cache-Control: no-store）。
+	CacheNoStore
+)
+
+type cacheModeKey struct{}
+
+// WithCacheMode returns a copy of ctx that makes every Cache use mode.
+// WithCacheMode 返回 ctx 的一个副本，使每个 Cache 都使用 mode。
+func WithCacheMode(ctx context.Context, mode CacheMode) context.Context {
+	return context.WithValue(ctx, cacheModeKey{}, mode)
+}
+
+func cacheModeFrom(ctx context.Context) CacheMode {
+	mode, _ := ctx.Value(cacheModeKey{}).(CacheMode)
+	return mode
+}
+
+// CacheStats counts how a Cache answered.
+// CacheStats 统计 Cache 是如何回答的。
+type CacheStats struct {
+	Hits      int64 // answered from the cache 从缓存中回答
+	Misses    int64 // sent to the backend 发送给了后端
+	Coalesced int64 // waited for another caller's identical backend call 等待了其他调用者相同的后端调用
+	Entries   int   // results currently cached 当前缓存的结果数
+}
+
+// A Cache is a Backend that keeps the results of its backend for TTL, at
+// most MaxEntries of them with the least recently used evicted first. Keys
+// are normalized queries, so "Go  Context" and "go context" share an entry.
+// Concurrent misses on one key cause a single backend call; a caller that
+// gives up waiting does not cancel that call for the others, only the last
+// one leaving does. A Cache must not be copied after first use.
+// Cache 是一个把后端结果保留 TTL 时长的 Backend，最多保留 MaxEntries 条，
+// 最近最少使用的条目最先被淘汰。键是规范化后的查询，因此 "Go  Context" 与 "go context"
+// 共享一条缓存。同一个键上并发的未命中只会引起一次后端调用；放弃等待的调用者不会为其他
+// 调用者取消这次调用，只有最后一个离开的调用者才会取消它。Cache 第一次使用后不能被拷贝。
+type Cache struct {
+	Backend    Backend
+	TTL        time.Duration    // 0 means one minute，0 表示一分钟
+	MaxEntries int              // 0 means 1024，0 表示 1024
+	Now        func() time.Time // nil means time.Now，nil 表示 time.Now
+
+	hits, misses, coalesced atomic.Int64
+
+	mu    sync.Mutex
+	lru   *list.List               //最近使用的条目在前
+	items map[string]*list.Element //键 -> lru 中的 *cacheEntry
+	calls map[string]*cacheCall    //键 -> 进行中的后端调用
+}
+
+type cacheEntry struct {
+	key     string
+	results Results
+	expires time.Time
+}
+
+// cacheCall is one backend call shared by every caller that missed on its key.
+// cacheCall 是由在同一个键上未命中的所有调用者共享的一次后端调用。
+type cacheCall struct {
+	done    chan struct{} // closed when results and err are set 设置好 results 与 err 后关闭
+	results Results
+	err     error
+	waiters int                // callers still waiting 仍在等待的调用者数
+	cancel  context.CancelFunc // cancels the shared call 取消共享的调用
+}
+
+var _ Backend = (*Cache)(nil)
+
+// NewCache returns a Cache with default settings around backend.
+// NewCache 返回一个包装了 backend、使用默认设置的 Cache。
+func NewCache(backend Backend) *Cache {
+	return &Cache{Backend: backend}
+}
+
+// NormalizeQuery returns the cache key of query: lower case, with runs of
+// white space collapsed to one space.
+// NormalizeQuery 返回 query 的缓存键：小写，并把连续的空白压缩为一个空格。
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// Stats returns the counters of the cache.
+// Stats 返回缓存的计数器。
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.items)
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Coalesced: c.coalesced.Load(), Entries: entries}
+}
+
+// Search answers from the cache or from a backend call shared with the other
+// callers asking for the same normalized query, honoring the CacheMode of ctx.
+// Search 从缓存中回答，或者从与其他查询同一规范化查询的调用者共享的后端调用中回答，
+// 并遵守 ctx 中的 CacheMode。
+func (c *Cache) Search(ctx context.Context, query string) (Results, error) {
+	mode := cacheModeFrom(ctx)
+	if mode == CacheNoStore {
+		c.misses.Add(1)
+		return c.Backend.Search(ctx, query)
+	}
+	key := NormalizeQuery(query)
+	now := c.now()
+
+	c.mu.Lock()
+	c.init()
+	if mode == CacheDefault {
+		if el, ok := c.items[key]; ok {
+			e := el.Value.(*cacheEntry)
+			if now.Before(e.expires) {
+				c.lru.MoveToFront(el)
+				c.mu.Unlock()
+				c.hits.Add(1)
+				return slices.Clone(e.results), nil
+			}
+			c.lru.Remove(el)
+			delete(c.items, key)
+		}
+	}
+	call, ok := c.calls[key]
+	if ok {
+		c.coalesced.Add(1)
+	} else {
+		c.misses.Add(1)
+		call = c.startCall(ctx, key, query)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return slices.Clone(call.results), call.err
+	case <-ctx.Done():
+		c.leave(key, call)
+		return nil, ctx.Err()
+	}
+}
+
+// startCall runs the backend for key in a new goroutine; c.mu must be held.
+// The call's context keeps the values of ctx (such as the user IP) but not
+// its cancellation, which is governed by the waiters instead.
+// startCall 在新的 goroutine 中为 key 运行后端，调用时必须持有 c.mu。调用的 context
+// 保留了 ctx 中的值（例如用户 IP），但不继承它的取消，取消改由等待者决定。
+func (c *Cache) startCall(ctx context.Context, key, query string) *cacheCall {
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	call := &cacheCall{done: make(chan struct{}), cancel: cancel}
+	c.calls[key] = call
+	go func() {
+		defer cancel()
+		results, err := c.Backend.Search(callCtx, query)
+		c.mu.Lock()
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+		if err == nil {
+			c.store(key, results)
+		}
+		call.results, call.err = results, err
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// leave unregisters a waiter that gave up; the last one out cancels the call.
+// leave 注销一个放弃等待的调用者；最后一个离开的调用者取消这次调用。
+func (c *Cache) leave(key string, call *cacheCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call.waiters--; call.waiters > 0 {
+		return
+	}
+	call.cancel()
+	//已被放弃的调用不能再被新的调用者加入，否则它们只会得到取消错误。
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+}
+
+// store caches results under key and evicts the least recently used entries
+// beyond MaxEntries; c.mu must be held.
+func (c *Cache) store(key string, results Results) {
+	e := &cacheEntry{key: key, results: results, expires: c.now().Add(c.ttl())}
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[key] = c.lru.PushFront(e)
+	}
+	for c.lru.Len() > c.maxEntries() {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *Cache) init() {
+	if c.items == nil {
+		c.lru = list.New()
+		c.items = make(map[string]*list.Element)
+		c.calls = make(map[string]*cacheCall)
+	}
+}
+
+func (c *Cache) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return time.Minute
+}
+
+func (c *Cache) maxEntries() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return 1024
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
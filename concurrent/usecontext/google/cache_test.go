@@ -0,0 +1,139 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBackend 统计被调用的次数，并返回以查询为标题的一个结果。
+type countingBackend struct {
+	calls   atomic.Int32
+	release chan struct{} // 不为 nil 时，每次调用都阻塞到它被关闭或者 ctx 结束
+}
+
+func (b *countingBackend) Search(ctx context.Context, query string) (Results, error) {
+	b.calls.Add(1)
+	if b.release != nil {
+		select {
+		case <-b.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return Results{{Title: query, URL: "https://example.com/" + query}}, nil
+}
+
+func TestCacheTTLAndLRU(t *testing.T) {
+	now := time.Unix(0, 0)
+	backend := &countingBackend{}
+	c := &Cache{Backend: backend, TTL: time.Minute, MaxEntries: 2, Now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	c.Search(ctx, "Go  Context")
+	if r, _ := c.Search(ctx, "go context"); len(r) != 1 || backend.calls.Load() != 1 {
+		t.Fatalf("normalized query missed the cache: %d calls", backend.calls.Load())
+	}
+	c.Search(ctx, "b")
+	c.Search(ctx, "c") //淘汰最近最少使用的 "go context"
+	c.Search(ctx, "go context")
+	if n := backend.calls.Load(); n != 4 {
+		t.Errorf("LRU eviction: %d calls, want 4", n)
+	}
+	now = now.Add(time.Minute)
+	c.Search(ctx, "go context")
+	if n := backend.calls.Load(); n != 5 {
+		t.Errorf("expired entry: %d calls, want 5", n)
+	}
+	if st := c.Stats(); st.Hits != 1 || st.Misses != 5 || st.Entries != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestCacheModes(t *testing.T) {
+	backend := &countingBackend{}
+	c := NewCache(backend)
+	ctx := context.Background()
+	c.Search(ctx, "q")
+	c.Search(WithCacheMode(ctx, CacheNoCache), "q")
+	if n := backend.calls.Load(); n != 2 {
+		t.Errorf("no-cache: %d calls, want 2", n)
+	}
+	c.Search(WithCacheMode(ctx, CacheNoStore), "fresh")
+	c.Search(ctx, "fresh")
+	if n := backend.calls.Load(); n != 4 {
+		t.Errorf("no-store results must not be cached: %d calls, want 4", n)
+	}
+}
+
+func TestCacheCoalescesConcurrentMisses(t *testing.T) {
+	backend := &countingBackend{release: make(chan struct{})}
+	c := NewCache(backend)
+	const callers = 10
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			if r, err := c.Search(context.Background(), "q"); err != nil || len(r) != 1 {
+				t.Errorf("Search = %v, %v", r, err)
+			}
+		}()
+	}
+	for c.Stats().Misses+c.Stats().Coalesced < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(backend.release)
+	wg.Wait()
+	if n := backend.calls.Load(); n != 1 {
+		t.Errorf("%d backend calls for %d concurrent misses, want 1", n, callers)
+	}
+}
+
+func TestCacheWaiterCancelDoesNotCancelSharedCall(t *testing.T) {
+	backend := &countingBackend{release: make(chan struct{})}
+	c := NewCache(backend)
+	impatient, cancel := context.WithCancel(context.Background())
+	chErr := make(chan error, 1)
+	go func() {
+		_, err := c.Search(impatient, "q")
+		chErr <- err
+	}()
+	for backend.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	chResult := make(chan Results, 1)
+	go func() {
+		r, _ := c.Search(context.Background(), "q")
+		chResult <- r
+	}()
+	for c.Stats().Coalesced == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-chErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("impatient caller: err = %v", err)
+	}
+	close(backend.release)
+	if r := <-chResult; len(r) != 1 {
+		t.Errorf("patient caller got %v; the shared call was canceled", r)
+	}
+}
+
+func TestCacheLastWaiterCancelsSharedCall(t *testing.T) {
+	backend := &countingBackend{release: make(chan struct{})}
+	c := NewCache(backend)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Search(ctx, "q"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	//被放弃的调用已被取消，新的调用者会发起新的后端调用。
+	close(backend.release)
+	if r, err := c.Search(context.Background(), "q"); err != nil || len(r) != 1 || backend.calls.Load() != 2 {
+		t.Errorf("Search = %v, %v after %d calls", r, err, backend.calls.Load())
+	}
+}
@@ -0,0 +1,223 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/canceltrace"
+)
+
+// A Source is a named Backend taking part in a federated search.
+// Source 是参与联合搜索（federated search）的一个具名 Backend。
+type Source struct {
+	Name    string
+	Backend Backend
+	// Timeout is the sub-deadline of this source, measured from the start of
+	// the search. It can only shorten the caller's deadline, never extend it;
+	// 0 means the source may use all of the caller's time.
+	// Timeout 是该来源的子截止时间，从搜索开始时计算。它只能缩短调用者的截止时间，
+	// 而不能延长；0 表示该来源可以用完调用者的全部时间。
+	Timeout time.Duration
+}
+
+// Status tells how a source took part in a federated search.
+// Status 说明一个来源在联合搜索中的结局。
+type Status string
+
+const (
+	StatusAnswered Status = "answered" // the backend returned results 后端返回了结果
+	StatusFailed   Status = "failed"   // the backend returned an error of its own 后端自身返回了错误
+	StatusCanceled Status = "canceled" // the source's context was done first 来源的context先结束了
+)
+
+// A SourceReport describes the outcome of one source of a federated search.
+// SourceReport 描述联合搜索中一个来源的结果。
+type SourceReport struct {
+	Name    string
+	Status  Status
+	Results int           // number of results the source returned 该来源返回的结果数
+	Elapsed time.Duration // time the source took 该来源所用的时间
+	Err     error         // why the source failed or was canceled 来源失败或被取消的原因
+}
+
+// Federation fans a query out to all of its Sources at once and merges the
+// answers. A Federation is itself a Backend, so it can be nested.
+// Federation 把一个查询同时分发（fan out）给所有来源，再合并它们的答案。
+// Federation 本身也是一个 Backend，因此可以嵌套使用。
+type Federation struct {
+	Sources []Source
+}
+
+var _ Backend = (*Federation)(nil)
+
+// Search returns the merged results of SearchReport.
+// Search 返回 SearchReport 合并后的结果。
+func (f *Federation) Search(ctx context.Context, query string) (Results, error) {
+	results, _, err := f.SearchReport(ctx, query)
+	return results, err
+}
+
+// SearchReport queries every source concurrently, each under its own child
+// context, and waits until all of them have answered, failed or been
+// canceled. Results are merged in source order and de-duplicated by URL.
+// Partial results are returned with a nil error as long as one source
+// answered; otherwise the error is ctx.Err() if ctx is done, or the joined
+// errors of the sources.
+// SearchReport 并发查询所有来源，每个来源都运行在自己的子 context 中，并等待它们全部
+// 回答、失败或被取消。结果按来源的顺序合并，并按 URL 去重。只要有一个来源回答了，
+// 就返回部分结果和 nil error；否则，若 ctx 已结束则返回 ctx.Err()，不然返回各来源错误的合并。
+func (f *Federation) SearchReport(ctx context.Context, query string) (Results, []SourceReport, error) {
+	answers := make([]answer, len(f.Sources))
+	if err := f.fanOut(ctx, query, func(a answer) { answers[a.i] = a }); err != nil {
+		return nil, nil, err
+	}
+	var merged Results
+	seen := make(map[string]bool)
+	for _, a := range answers {
+		merged = appendNew(merged, seen, a.results)
+	}
+	reports, err := f.summarize(ctx, answers)
+	if err != nil {
+		return nil, reports, err
+	}
+	return merged, reports, nil
+}
+
+// StreamReport is like SearchReport but hands every new result to emit as
+// soon as its source answers, so results arrive in completion order rather
+// than source order. emit is called from the caller's goroutine.
+// StreamReport 与 SearchReport 类似，但在来源一回答时就把每个新结果交给 emit，
+// 因此结果按完成的顺序而不是来源的顺序到达。emit 在调用者的 goroutine 中被调用。
+func (f *Federation) StreamReport(ctx context.Context, query string, emit func(Result)) ([]SourceReport, error) {
+	answers := make([]answer, len(f.Sources))
+	seen := make(map[string]bool)
+	err := f.fanOut(ctx, query, func(a answer) {
+		answers[a.i] = a
+		for _, r := range appendNew(nil, seen, a.results) {
+			emit(r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.summarize(ctx, answers)
+}
+
+// StreamSources is like StreamReport but hands emit every result of every
+// source, duplicates included, together with the source's name and the
+// result's rank (from 0) in that source's answer. Callers that resume an
+// interrupted stream can skip what they already delivered per source,
+// whatever order the sources answer in this time.
+// StreamSources 与 StreamReport 类似，但把每个来源的每个结果（包括重复的结果）连同来源的
+// 名称以及该结果在来源答案中的序号（从 0 开始）一起交给 emit。恢复被中断的流的调用者可以
+// 按来源跳过已经交付的内容，而不管这一次各来源以什么顺序回答。
+func (f *Federation) StreamSources(ctx context.Context, query string, emit func(source string, rank int, r Result)) ([]SourceReport, error) {
+	answers := make([]answer, len(f.Sources))
+	err := f.fanOut(ctx, query, func(a answer) {
+		answers[a.i] = a
+		for rank, r := range a.results {
+			emit(a.report.Name, rank, r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.summarize(ctx, answers)
+}
+
+// answer is what one source produced.
+type answer struct {
+	i       int
+	results Results
+	report  SourceReport
+}
+
+// fanOut runs every source in its own goroutine and passes their answers to
+// collect, in completion order, until all of them are in.
+// fanOut 在各自的 goroutine 中运行每个来源，并按完成的顺序把它们的答案交给 collect，
+// 直到所有答案都到齐。
+func (f *Federation) fanOut(ctx context.Context, query string, collect func(answer)) error {
+	if len(f.Sources) == 0 {
+		return errors.New("google: federation has no sources")
+	}
+	//带缓冲的通道保证即使调用者不再接收，各个来源的 goroutine 也能发送后退出，不会泄漏。
+	chAnswer := make(chan answer, len(f.Sources))
+	for i, src := range f.Sources {
+		go func() {
+			//每个来源都是请求取消跟踪中的一个具名作用域，记录它为何结束。
+			var (
+				sctx   context.Context
+				cancel context.CancelCauseFunc
+			)
+			if src.Timeout > 0 {
+				sctx, cancel = canceltrace.WithTimeout(ctx, "source "+src.Name, src.Timeout)
+			} else {
+				sctx, cancel = canceltrace.WithCancel(ctx, "source "+src.Name)
+			}
+			start := time.Now()
+			results, err := src.Backend.Search(sctx, query)
+			a := answer{i: i, results: results, report: SourceReport{
+				Name:    src.Name,
+				Results: len(results),
+				Elapsed: time.Since(start),
+				Err:     err,
+			}}
+			switch {
+			case err == nil:
+				a.report.Status = StatusAnswered
+				cancel(canceltrace.ErrReturned)
+			case sctx.Err() != nil:
+				//子context已结束（超时或者父context被取消），后端的错误只是取消的结果。
+				a.report.Status = StatusCanceled
+				if cause := context.Cause(sctx); !errors.Is(err, cause) {
+					a.report.Err = fmt.Errorf("%w: %w", err, cause)
+				}
+				cancel(nil)
+			default:
+				a.report.Status = StatusFailed
+				cancel(&canceltrace.UpstreamError{Name: src.Name, Err: err})
+			}
+			chAnswer <- a
+		}()
+	}
+	for range f.Sources {
+		collect(<-chAnswer)
+	}
+	return nil
+}
+
+// summarize collects the reports of answers and decides the overall error.
+func (f *Federation) summarize(ctx context.Context, answers []answer) ([]SourceReport, error) {
+	reports := make([]SourceReport, len(answers))
+	answered := false
+	var errs []error
+	for i, a := range answers {
+		reports[i] = a.report
+		if a.report.Status == StatusAnswered {
+			answered = true
+		} else {
+			errs = append(errs, fmt.Errorf("%s: %w", a.report.Name, a.report.Err))
+		}
+	}
+	switch {
+	case answered:
+		return reports, nil
+	case ctx.Err() != nil:
+		return reports, ctx.Err()
+	default:
+		return reports, errors.Join(errs...)
+	}
+}
+
+// appendNew appends the results whose URL is not yet in seen.
+func appendNew(dst Results, seen map[string]bool, results Results) Results {
+	for _, r := range results {
+		if !seen[r.URL] {
+			seen[r.URL] = true
+			dst = append(dst, r)
+		}
+	}
+	return dst
+}
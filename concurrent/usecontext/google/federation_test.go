@@ -0,0 +1,91 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowBackend 在给定时延后返回结果，或者在 ctx 结束时返回 ctx.Err()。
+func slowBackend(delay time.Duration, results ...Result) Backend {
+	return BackendFunc(func(ctx context.Context, query string) (Results, error) {
+		select {
+		case <-time.After(delay):
+			return results, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+func TestFederationMergesPartialResults(t *testing.T) {
+	a := Result{Title: "A", URL: "https://a.example/"}
+	b := Result{Title: "B", URL: "https://b.example/"}
+	f := &Federation{Sources: []Source{
+		{Name: "fast", Backend: slowBackend(0, a, b)},
+		{Name: "dup", Backend: slowBackend(10*time.Millisecond, b)},
+		{Name: "slow", Backend: slowBackend(time.Minute, a), Timeout: 20 * time.Millisecond},
+		{Name: "broken", Backend: BackendFunc(func(context.Context, string) (Results, error) {
+			return nil, errors.New("boom")
+		})},
+	}}
+	results, reports, err := f.SearchReport(context.Background(), "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0] != a || results[1] != b {
+		t.Errorf("results = %v, want [a b]", results)
+	}
+	want := []Status{StatusAnswered, StatusAnswered, StatusCanceled, StatusFailed}
+	for i, r := range reports {
+		if r.Status != want[i] {
+			t.Errorf("%s: status = %s, want %s", r.Name, r.Status, want[i])
+		}
+	}
+	if !errors.Is(reports[2].Err, context.DeadlineExceeded) {
+		t.Errorf("slow source err = %v, want deadline exceeded", reports[2].Err)
+	}
+}
+
+func TestFederationAllCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	f := &Federation{Sources: []Source{
+		{Name: "s1", Backend: slowBackend(time.Minute)},
+		{Name: "s2", Backend: slowBackend(time.Minute)},
+	}}
+	start := time.Now()
+	_, reports, err := f.SearchReport(ctx, "q")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search took %v after the deadline", elapsed)
+	}
+	for _, r := range reports {
+		if r.Status != StatusCanceled {
+			t.Errorf("%s: status = %s, want canceled", r.Name, r.Status)
+		}
+	}
+}
+
+func TestFederationStreamsInCompletionOrder(t *testing.T) {
+	a := Result{Title: "A", URL: "https://a.example/"}
+	b := Result{Title: "B", URL: "https://b.example/"}
+	f := &Federation{Sources: []Source{
+		{Name: "slow", Backend: slowBackend(30*time.Millisecond, a, b)},
+		{Name: "fast", Backend: slowBackend(0, b)},
+	}}
+	var got Results
+	reports, err := f.StreamReport(context.Background(), "q", func(r Result) { got = append(got, r) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != b || got[1] != a {
+		t.Errorf("streamed %v, want [b a]", got)
+	}
+	if reports[0].Results != 2 || reports[1].Results != 1 {
+		t.Errorf("reports = %+v", reports)
+	}
+}
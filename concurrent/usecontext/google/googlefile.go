@@ -58,15 +58,59 @@ type Results []Result
 // A Result contains the title and URL of a search result.
 // Result 包含搜索结果的标题和 URL。
 type Result struct {
-	Title, URL string
+	Title string `json:"title"`
+	URL   string `json:"url"`
 }
 
+// WebBackend is the Backend that talks to the (retired) Google AJAX Web Search API.
+// WebBackend 是访问（已停用的）Google AJAX Web 搜索 API 的 Backend。
+type WebBackend struct {
+	// Client is the HTTP client used for the request; nil means http.DefaultClient.
+	// Client 是发送请求所用的 HTTP 客户端，为 nil 时使用 http.DefaultClient。
+	Client *http.Client
+	// Endpoint is the URL of the search API; "" means the Google AJAX endpoint.
+	// Endpoint 是搜索 API 的 URL，"" 表示 Google AJAX 端点。
+	Endpoint string
+	// Retry is the retry policy of upstream requests; nil means a single try.
+	// Retry 是上游请求的重试策略，nil 表示只尝试一次。
+	Retry *RetryPolicy
+	// Hedge, if set, sends duplicate requests when the upstream is slow.
+	// Hedge 如果不为空，则在上游较慢时发送重复的请求。
+	Hedge *HedgePolicy
+}
+
+// defaultEndpoint is the retired Google AJAX Web Search API.
+const defaultEndpoint = "https://ajax.googleapis.com/ajax/services/search/web?v=1.0"
+
+var _ Backend = (*WebBackend)(nil)
+
+// DefaultWebBackend is the WebBackend used by Search. It retries with
+// DefaultRetryPolicy.
+// DefaultWebBackend 是 Search 函数所使用的 WebBackend，它按照 DefaultRetryPolicy 重试。
+var DefaultWebBackend = &WebBackend{Retry: DefaultRetryPolicy()}
+
+// DefaultBreaker is the circuit breaker Search calls DefaultWebBackend through.
+// DefaultBreaker 是 Search 调用 DefaultWebBackend 时所经过的熔断器。
+var DefaultBreaker = NewBreaker("google", DefaultWebBackend)
+
 // Search sends query to Google search and returns the results.
+// While DefaultBreaker is open it fails fast with ErrBreakerOpen.
 // Search 向 Google 搜索发送查询并返回结果。
+// 当 DefaultBreaker 处于打开状态时，它以 ErrBreakerOpen 快速失败。
 func Search(ctx context.Context, query string) (Results, error) {
+	return DefaultBreaker.Search(ctx, query)
+}
+
+// Search sends query to Google search and returns the results.
+// Search 向 Google 搜索发送查询并返回结果。
+func (b *WebBackend) Search(ctx context.Context, query string) (Results, error) {
 	// Prepare the Google Search API request.
 	// 准备 Google 搜索 API 请求。
-	req, err := http.NewRequest("GET", "https://ajax.googleapis.com/ajax/services/search/web?v=1.0", nil)
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -111,23 +155,29 @@ func Search(ctx context.Context, query string) (Results, error) {
 		}
 		return nil
 	}
-	err = httpDo(ctx, req, responseHandler)
-	// httpDo waits for the closure we provided to return, so it's safe to
+	err = httpDo(ctx, upstream{client: b.client(), retry: b.Retry, hedge: b.Hedge}, req, responseHandler)
+	if err != nil {
+		// httpDo may return before the closure when ctx is done, so results
+		// must not be read then.
+		// ctx 结束时 httpDo 可能在闭包返回之前就返回了，此时不能读取 results。
+		return nil, err
+	}
+	// httpDo waited for the closure we provided to return, so it's safe to
 	// read results here.
-	return results, err
+	return results, nil
 }
 
 // httpDo 发出 HTTP 请求并调用 f 处理响应。
-// 如果 ctx.Done 在请求或 f 运行时关闭，httpDo 将取消请求，等待 f 退出，并返回 ctx.Err。
+// 如果 ctx.Done 在请求或 f 运行时关闭，httpDo 将取消请求，并返回 ctx.Err。
 // 否则，httpDo 返回 f 的错误。
-func httpDo(ctx context.Context, req *http.Request, f func(*http.Response, error) error) error {
+// 请求经由 u 发出：失败时按照其重试策略重试，较慢时按照其对冲策略发送重复请求，
+// f 只会看到最终胜出的那个结果。
+func httpDo(ctx context.Context, u upstream, req *http.Request, f func(*http.Response, error) error) error {
 
 	chErr := make(chan error, 1)
 
-	req = req.WithContext(ctx)
-
 	go func() {
-		chErr <- f(http.DefaultClient.Do(req))
+		chErr <- f(u.do(ctx, req))
 	}() // 在 goroutine 中运行 HTTP 请求，并将响应传递给 f进行处理，f是响应处理函数。
 
 	select {
@@ -137,3 +187,31 @@ func httpDo(ctx context.Context, req *http.Request, f func(*http.Response, error
 		return err
 	}
 }
+
+// upstream bundles how httpDo reaches the search API.
+// upstream 汇集了 httpDo 访问搜索 API 的方式。
+type upstream struct {
+	client *http.Client
+	retry  *RetryPolicy // nil 表示只尝试一次
+	hedge  *HedgePolicy // nil 表示不对冲
+}
+
+// do sends req. Every hedged copy runs its own retry loop under its own child
+// context; requests with a body are never hedged.
+// do 发送 req。每个对冲副本都在自己的子 context 中运行自己的重试循环；带请求体的请求从不对冲。
+func (u upstream) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	send := func(ctx context.Context) (*http.Response, error) {
+		return u.retry.do(ctx, u.client, req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return send(ctx)
+	}
+	return u.hedge.do(ctx, send)
+}
+
+func (b *WebBackend) client() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	return http.DefaultClient
+}
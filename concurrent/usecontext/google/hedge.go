@@ -0,0 +1,186 @@
+package google
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A HedgePolicy makes httpDo send a duplicate ("hedged") request when the
+// first one has not answered within the Percentile latency of recent
+// requests. The first successful response wins; the others are canceled
+// through their own child contexts. Only requests without a body are hedged.
+// A HedgePolicy must not be copied after first use.
+// HedgePolicy 让 httpDo 在第一个请求超过近期请求延迟的 Percentile 分位数仍未应答时，
+// 再发送一个重复的（“对冲”）请求。第一个成功的响应胜出，其他请求通过各自的子 context
+// 被取消。只有不带请求体的请求才会被对冲。HedgePolicy 第一次使用后不能被拷贝。
+type HedgePolicy struct {
+	// Percentile (0 to 1) of the recent latencies to wait before hedging; 0 means 0.95.
+	// Percentile 是对冲之前要等待的近期延迟分位数（0 到 1），0 表示 0.95。
+	Percentile float64
+	// MinDelay and MaxDelay clamp the hedge delay. Until there are latency
+	// samples the delay is MaxDelay (or 1s if MaxDelay is 0).
+	// MinDelay 与 MaxDelay 限定对冲延迟的范围。在有延迟样本之前，延迟为 MaxDelay（若为 0 则为 1s）。
+	MinDelay, MaxDelay time.Duration
+	// MaxHedges is the number of duplicates sent at most; 0 means 1.
+	// MaxHedges 是最多发送的重复请求数，0 表示 1。
+	MaxHedges int
+	// Window is the number of recent latencies kept; 0 means 128.
+	// Window 是保留的近期延迟样本数，0 表示 128。
+	Window int
+
+	mu      sync.Mutex
+	samples []time.Duration //环形缓冲区，保存最近 Window 个成功请求的延迟
+	next    int
+}
+
+// Delay returns the current hedge delay: the Percentile of the recent
+// latencies, clamped to [MinDelay, MaxDelay].
+// Delay 返回当前的对冲延迟：近期延迟的 Percentile 分位数，并限定在 [MinDelay, MaxDelay] 之内。
+func (h *HedgePolicy) Delay() time.Duration {
+	h.mu.Lock()
+	sorted := slices.Clone(h.samples)
+	h.mu.Unlock()
+	if len(sorted) == 0 {
+		if h.MaxDelay > 0 {
+			return h.MaxDelay
+		}
+		return time.Second
+	}
+	slices.Sort(sorted)
+	p := h.Percentile
+	if p <= 0 || p > 1 {
+		p = 0.95
+	}
+	d := sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+	if d < h.MinDelay {
+		d = h.MinDelay
+	}
+	if h.MaxDelay > 0 && d > h.MaxDelay {
+		d = h.MaxDelay
+	}
+	return d
+}
+
+// Observe adds the latency of a successful request to the rolling window.
+// Observe 把一个成功请求的延迟加入滚动窗口。
+func (h *HedgePolicy) Observe(d time.Duration) {
+	window := h.Window
+	if window <= 0 {
+		window = 128
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < window {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next%len(h.samples)] = d
+	h.next++
+}
+
+// hedgeOutcome is what one of the hedged copies of a request produced.
+type hedgeOutcome struct {
+	i     int // index of the copy, 0 for the original 副本的序号，原始请求为 0
+	resp  *http.Response
+	err   error
+	start time.Time
+}
+
+// do runs send and, while it is slow, up to MaxHedges copies of it, each
+// under its own child context of ctx. The winning response's context is
+// released when its body is closed. A nil policy just calls send.
+// do 运行 send，并在其较慢时最多再运行 MaxHedges 个副本，每个副本都运行在 ctx 的
+// 一个独立子 context 中。胜出响应的 context 在其响应体关闭时才被释放。nil 策略只是调用 send。
+func (h *HedgePolicy) do(ctx context.Context, send func(context.Context) (*http.Response, error)) (*http.Response, error) {
+	if h == nil {
+		return send(ctx)
+	}
+	maxHedges := h.MaxHedges
+	if maxHedges <= 0 {
+		maxHedges = 1
+	}
+	chOutcome := make(chan hedgeOutcome, 1+maxHedges)
+	var cancels []context.CancelFunc
+	launch := func() {
+		cctx, cancel := context.WithCancel(ctx)
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		start := time.Now()
+		go func() {
+			resp, err := send(cctx)
+			chOutcome <- hedgeOutcome{i, resp, err, start}
+		}()
+	}
+
+	launch()
+	inFlight, delay := 1, h.Delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var last hedgeOutcome
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			//前面的请求迟迟没有应答：再发送一个对冲请求。
+			if len(cancels) <= maxHedges {
+				launch()
+				inFlight++
+				timer.Reset(delay)
+			}
+		case o := <-chOutcome:
+			inFlight--
+			if o.err == nil && o.resp.StatusCode < 500 {
+				h.Observe(time.Since(o.start))
+				//取消落败的请求，它们的 send 会因各自的子 context 被取消而尽快返回。
+				for i, cancel := range cancels {
+					if i != o.i {
+						cancel()
+					}
+				}
+				go drain(chOutcome, inFlight)
+				o.resp.Body = &cancelOnClose{ReadCloser: o.resp.Body, cancel: cancels[o.i]}
+				return o.resp, nil
+			}
+			if last.resp != nil {
+				last.resp.Body.Close()
+			}
+			if last.start != (time.Time{}) {
+				cancels[last.i]()
+			}
+			last = o
+		}
+	}
+	//所有请求都失败了：返回最后一个失败的结果。
+	if last.resp != nil {
+		last.resp.Body = &cancelOnClose{ReadCloser: last.resp.Body, cancel: cancels[last.i]}
+	} else {
+		cancels[last.i]()
+	}
+	return last.resp, last.err
+}
+
+// drain closes the responses of the n losers still in flight.
+// drain 关闭仍在进行中的 n 个落败请求的响应。
+func drain(chOutcome <-chan hedgeOutcome, n int) {
+	for ; n > 0; n-- {
+		if o := <-chOutcome; o.resp != nil {
+			o.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases the context of a hedged request when its body is closed.
+// cancelOnClose 在对冲请求的响应体关闭时释放其 context。
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,67 @@
+package google
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeDelayAdapts(t *testing.T) {
+	h := &HedgePolicy{Percentile: 0.9, MinDelay: 5 * time.Millisecond, MaxDelay: time.Second, Window: 10}
+	if d := h.Delay(); d != time.Second {
+		t.Errorf("delay without samples = %v, want MaxDelay", d)
+	}
+	for i := 1; i <= 10; i++ {
+		h.Observe(time.Duration(i) * 10 * time.Millisecond)
+	}
+	if d := h.Delay(); d != 100*time.Millisecond {
+		t.Errorf("p90 delay = %v, want 100ms", d)
+	}
+	//新样本挤出旧样本：窗口中只剩下 1ms 的延迟，结果被 MinDelay 托底。
+	for i := 0; i < 10; i++ {
+		h.Observe(time.Millisecond)
+	}
+	if d := h.Delay(); d != 5*time.Millisecond {
+		t.Errorf("delay after fast samples = %v, want MinDelay", d)
+	}
+}
+
+func TestHedgedRequestWinsAndCancelsLoser(t *testing.T) {
+	var calls atomic.Int32
+	loserCanceled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) == 1 {
+			//第一个请求卡住，直到客户端取消它。
+			<-req.Context().Done()
+			close(loserCanceled)
+			return
+		}
+		w.Write([]byte(`{"responseData":{"results":[{"titleNoFormatting":"hedged","url":"https://go.dev/"}]}}`))
+	}))
+	defer ts.Close()
+
+	hedge := &HedgePolicy{MaxDelay: 20 * time.Millisecond}
+	b := &WebBackend{Endpoint: ts.URL, Hedge: hedge}
+	start := time.Now()
+	results, err := b.Search(context.Background(), "golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Title != "hedged" || time.Since(start) > time.Second {
+		t.Errorf("results = %v after %v", results, time.Since(start))
+	}
+	select {
+	case <-loserCanceled:
+	case <-time.After(time.Second):
+		t.Error("the slow request was not canceled")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("%d requests sent, want 2", calls.Load())
+	}
+	if d := hedge.Delay(); d >= 20*time.Millisecond {
+		t.Errorf("delay %v did not adapt to the fast response", d)
+	}
+}
@@ -0,0 +1,189 @@
+package google
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Document is one entry of a local Index.
+// Document 是本地索引（Index）中的一条文档。
+type Document struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Body  string `json:"body"`
+}
+
+// Index is an offline Backend: an in-memory inverted index over a fixed set of
+// documents. Results are ranked by TF-IDF, with title terms counting double.
+// An Index is immutable after construction and safe for concurrent use.
+// Index 是一个离线的 Backend：基于固定文档集合的内存倒排索引。
+// 结果按 TF-IDF 排序，标题中的词按两倍计算。Index 构建后不可变，可以被并发使用。
+type Index struct {
+	// Limit caps the number of returned results; 0 means no limit.
+	// Limit 限制返回结果的数量，0 表示不限制。
+	Limit int
+
+	docs     []Document
+	postings map[string][]posting //词 -> 出现该词的文档及词频
+}
+
+// posting records how often a term occurs in the document docs[doc].
+type posting struct {
+	doc int
+	tf  int
+}
+
+var _ Backend = (*Index)(nil)
+
+// NewIndex builds an Index over docs.
+// NewIndex 根据 docs 构建索引。
+func NewIndex(docs []Document) *Index {
+	ix := &Index{docs: docs, postings: make(map[string][]posting)}
+	for i, d := range docs {
+		tf := make(map[string]int)
+		for _, t := range tokenize(d.Title) {
+			tf[t] += 2 //标题中的词权重加倍
+		}
+		for _, t := range tokenize(d.Body) {
+			tf[t]++
+		}
+		for t, n := range tf {
+			ix.postings[t] = append(ix.postings[t], posting{doc: i, tf: n})
+		}
+	}
+	return ix
+}
+
+// LoadIndex reads documents from a .json or .csv file and indexes them.
+// LoadIndex 从 .json 或 .csv 文件中读取文档并建立索引。
+func LoadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var docs []Document
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		docs, err = ReadDocumentsJSON(f)
+	case ".csv":
+		docs, err = ReadDocumentsCSV(f)
+	default:
+		return nil, fmt.Errorf("google: unsupported index file type %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("google: loading %s: %w", path, err)
+	}
+	return NewIndex(docs), nil
+}
+
+// ReadDocumentsJSON decodes a JSON array of documents.
+// ReadDocumentsJSON 解码一个文档的 JSON 数组。
+func ReadDocumentsJSON(r io.Reader) ([]Document, error) {
+	var docs []Document
+	if err := json.NewDecoder(r).Decode(&docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// ReadDocumentsCSV decodes CSV whose header row names the title, url and
+// (optional) body columns, in any order.
+// ReadDocumentsCSV 解码 CSV，其表头行以任意顺序给出 title、url 以及（可选的）body 列。
+func ReadDocumentsCSV(r io.Reader) ([]Document, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{"title": -1, "url": -1, "body": -1}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(h))
+		if _, ok := col[name]; ok {
+			col[name] = i
+		}
+	}
+	if col["title"] < 0 || col["url"] < 0 {
+		return nil, fmt.Errorf("csv header %q needs title and url columns", header)
+	}
+	field := func(rec []string, name string) string {
+		if i := col[name]; i >= 0 && i < len(rec) {
+			return rec[i]
+		}
+		return ""
+	}
+	var docs []Document
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, Document{
+			Title: field(rec, "title"),
+			URL:   field(rec, "url"),
+			Body:  field(rec, "body"),
+		})
+	}
+}
+
+// Len reports the number of indexed documents.
+func (ix *Index) Len() int { return len(ix.docs) }
+
+// Search returns the documents matching any term of query, best match first.
+// Search 返回与 query 中任意词匹配的文档，最匹配的排在最前面。
+func (ix *Index) Search(ctx context.Context, query string) (Results, error) {
+	scores := make(map[int]float64)
+	n := float64(len(ix.docs))
+	for _, t := range tokenize(query) {
+		//每处理一个词就检查一次取消信号，使大索引上的查询也能被及时中止。
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ps := ix.postings[t]
+		if len(ps) == 0 {
+			continue
+		}
+		idf := math.Log(1 + n/float64(len(ps)))
+		for _, p := range ps {
+			scores[p.doc] += float64(p.tf) * idf
+		}
+	}
+	hits := make([]int, 0, len(scores))
+	for doc := range scores {
+		hits = append(hits, doc)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if scores[hits[i]] != scores[hits[j]] {
+			return scores[hits[i]] > scores[hits[j]]
+		}
+		return hits[i] < hits[j] //分数相同时保持文档的原始顺序，使结果稳定。
+	})
+	if ix.Limit > 0 && len(hits) > ix.Limit {
+		hits = hits[:ix.Limit]
+	}
+	results := make(Results, 0, len(hits))
+	for _, doc := range hits {
+		results = append(results, Result{Title: ix.docs[doc].Title, URL: ix.docs[doc].URL})
+	}
+	return results, nil
+}
+
+// tokenize lower-cases s and splits it into runs of letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
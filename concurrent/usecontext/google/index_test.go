@@ -0,0 +1,59 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIndexRanking(t *testing.T) {
+	ix, err := LoadIndex("../testdata/docs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := ix.Search(context.Background(), "context cancellation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("no results")
+	}
+	//标题中含有 context 的文档应当排在最前面。
+	if got := results[0].URL; got != "https://pkg.go.dev/context" && got != "https://go.dev/blog/context" {
+		t.Errorf("top result = %s, want a context page", got)
+	}
+	ix.Limit = 1
+	if results, _ = ix.Search(context.Background(), "go"); len(results) != 1 {
+		t.Errorf("Limit=1 returned %d results", len(results))
+	}
+}
+
+func TestIndexFromCSV(t *testing.T) {
+	docs, err := ReadDocumentsCSV(strings.NewReader("url,Title\nhttps://a.example/,Alpha beta\nhttps://b.example/,Beta gamma\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := NewIndex(docs).Search(context.Background(), "GAMMA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0] != (Result{Title: "Beta gamma", URL: "https://b.example/"}) {
+		t.Errorf("results = %v", results)
+	}
+	if _, err := ReadDocumentsCSV(strings.NewReader("name,body\nx,y\n")); err == nil {
+		t.Error("missing title/url columns should be an error")
+	}
+}
+
+func TestIndexCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ix, err := LoadIndex("../testdata/docs.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.Search(ctx, "go"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,178 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// A RetryPolicy tells httpDo how to retry a failed upstream request with
+// exponential backoff. Backoff sleeps end as soon as ctx is done, and a retry
+// that could not start before ctx's deadline is not attempted at all.
+// RetryPolicy 告诉 httpDo 如何以指数退避（exponential backoff）重试失败的上游请求。
+// ctx 一结束，退避等待就结束；无法在 ctx 截止时间之前开始的重试根本不会进行。
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, the first one included.
+	// MaxAttempts 是包括第一次在内的总尝试次数。
+	MaxAttempts int
+	// BaseDelay is the backoff before the second try; it doubles for each
+	// further try up to MaxDelay.
+	// BaseDelay 是第二次尝试之前的退避时间；之后每次翻倍，直到 MaxDelay。
+	BaseDelay, MaxDelay time.Duration
+	// Jitter is the fraction (0 to 1) of each delay that is randomized, so
+	// that many clients do not retry in lock step.
+	// Jitter 是每次延迟中被随机化的比例（0 到 1），避免许多客户端同步地重试。
+	Jitter float64
+	// RetryableStatus lists the response codes worth another try; nil means
+	// 429, 502, 503 and 504.
+	// RetryableStatus 列出值得再试一次的响应码；nil 表示 429、502、503 和 504。
+	RetryableStatus []int
+	// RetryableError reports whether a transport error is worth another try;
+	// nil means IsTransientError.
+	// RetryableError 报告一个传输错误是否值得再试一次；nil 表示使用 IsTransientError。
+	RetryableError func(error) bool
+	// OnAttempt, if set, is called after every try.
+	// OnAttempt 如果不为空，则在每次尝试之后被调用。
+	OnAttempt func(Attempt)
+}
+
+// An Attempt describes one try of a request made under a RetryPolicy.
+// Attempt 描述在 RetryPolicy 下对请求的一次尝试。
+type Attempt struct {
+	N       int           // 1 for the first try 第一次尝试为 1
+	Status  int           // response code, 0 if there was no response 响应码，没有响应时为 0
+	Err     error         // transport error, if any 传输错误（如果有）
+	Elapsed time.Duration // duration of this try 本次尝试的耗时
+	// Delay is the backoff before the next try, or 0 when this try is final.
+	// Delay 是下一次尝试之前的退避时间；如果这是最后一次尝试则为 0。
+	Delay time.Duration
+}
+
+// DefaultRetryPolicy returns a policy of 3 tries with a 100ms base delay,
+// a 2s cap and half of each delay jittered.
+// DefaultRetryPolicy 返回一个尝试 3 次、基础延迟 100ms、上限 2s、每次延迟一半随机化的策略。
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 2 * time.Second, Jitter: 0.5}
+}
+
+// IsTransientError reports whether err looks like a network hiccup: a
+// timeout, a reset or refused connection, or a connection closed mid-response.
+// Context cancellation is never transient.
+// IsTransientError 报告 err 是否像是一次网络抖动：超时、连接被重置或被拒绝，
+// 或者在响应中途关闭了连接。context 的取消永远不是暂时性的错误。
+func IsTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// do sends req under the policy and returns the last response or error. The
+// body of a request is replayed through req.GetBody; a request with a body
+// but no GetBody is tried only once. A nil policy means a single try.
+// do 按照策略发送 req，并返回最后一次的响应或错误。请求体通过 req.GetBody 重放；
+// 有请求体却没有 GetBody 的请求只尝试一次。nil 策略表示只尝试一次。
+func (p *RetryPolicy) do(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	maxAttempts := 1
+	if p != nil && p.MaxAttempts > 1 && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		maxAttempts = p.MaxAttempts
+	}
+	for n := 1; ; n++ {
+		r := req.Clone(ctx)
+		if n > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		start := time.Now()
+		resp, err := client.Do(r)
+		attempt := Attempt{N: n, Err: err, Elapsed: time.Since(start)}
+		if resp != nil {
+			attempt.Status = resp.StatusCode
+		}
+		if n < maxAttempts && p.retryable(resp, err) {
+			attempt.Delay = p.backoff(n, resp)
+			//如果退避之后已经超过了调用者的截止时间，就不再重试。
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= attempt.Delay {
+				attempt.Delay = 0
+			}
+		}
+		if p != nil && p.OnAttempt != nil {
+			p.OnAttempt(attempt)
+		}
+		if attempt.Delay == 0 {
+			return resp, err
+		}
+		if resp != nil {
+			//读完并关闭响应体，使底层的 TCP 连接可以被下一次尝试复用。
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(attempt.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		if p.RetryableError != nil {
+			return p.RetryableError(err)
+		}
+		return IsTransientError(err)
+	}
+	codes := p.RetryableStatus
+	if codes == nil {
+		codes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	return slices.Contains(codes, resp.StatusCode)
+}
+
+// backoff returns the delay after try n: BaseDelay·2^(n-1) capped at
+// MaxDelay, with Jitter of it randomized, but never less than the server's
+// Retry-After (still capped at MaxDelay).
+// backoff 返回第 n 次尝试之后的延迟：BaseDelay·2^(n-1)，上限为 MaxDelay，其中 Jitter
+// 比例的部分被随机化，但不少于服务器给出的 Retry-After（仍以 MaxDelay 为上限）。
+func (p *RetryPolicy) backoff(n int, resp *http.Response) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if j := min(max(p.Jitter, 0), 1); j > 0 {
+		d = time.Duration(float64(d) * (1 - j + j*rand.Float64()))
+	}
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			ra := time.Duration(secs) * time.Second
+			if p.MaxDelay > 0 && ra > p.MaxDelay {
+				ra = p.MaxDelay
+			}
+			d = max(d, ra)
+		}
+	}
+	if d <= 0 {
+		d = time.Millisecond //延迟为0表示不再重试，因此至少等待1毫秒。
+	}
+	return d
+}
@@ -0,0 +1,105 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer 在前 failures 次请求中返回 503，之后返回 Google AJAX 格式的结果。
+func flakyServer(failures int32) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if calls.Add(1) <= failures {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"responseData":{"results":[{"titleNoFormatting":"Go %s","url":"https://go.dev/"}]}}`, body)
+	}))
+	return ts, &calls
+}
+
+func TestWebBackendRetries(t *testing.T) {
+	ts, calls := flakyServer(2)
+	defer ts.Close()
+	var attempts []Attempt
+	b := &WebBackend{Endpoint: ts.URL, Retry: &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		OnAttempt:   func(a Attempt) { attempts = append(attempts, a) },
+	}}
+	results, err := b.Search(context.Background(), "golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || calls.Load() != 3 {
+		t.Errorf("results = %v after %d calls", results, calls.Load())
+	}
+	if len(attempts) != 3 || attempts[0].Status != 503 || attempts[0].Delay != time.Millisecond ||
+		attempts[1].Delay != 2*time.Millisecond || attempts[2].Status != 200 || attempts[2].Delay != 0 {
+		t.Errorf("attempts = %+v", attempts)
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	ts, _ := flakyServer(1)
+	defer ts.Close()
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader("body"))
+	p := &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	resp, err := p.do(context.Background(), http.DefaultClient, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); !strings.Contains(string(b), "Go body") {
+		t.Errorf("second try did not resend the body: %s", b)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	ts, calls := flakyServer(100)
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second}
+	start := time.Now()
+	err := httpDo(ctx, upstream{client: http.DefaultClient, retry: p}, mustGet(t, ts.URL), func(resp *http.Response, err error) error {
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return errors.New(resp.Status)
+	})
+	//1秒的退避会越过50毫秒的截止时间，因此只尝试一次就返回最后的响应。
+	if err == nil || calls.Load() != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("err = %v after %d calls in %v", err, calls.Load(), time.Since(start))
+	}
+}
+
+func TestRetryBackoffStopsOnCancel(t *testing.T) {
+	ts, _ := flakyServer(100)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Minute, OnAttempt: func(Attempt) { cancel() }}
+	_, err := p.do(ctx, http.DefaultClient, mustGet(t, ts.URL))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func mustGet(t *testing.T, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
@@ -2,86 +2,319 @@
 // the go.net Context API. It serves on port 8080.
 //
 // The /search endpoint accepts these query params:
-//   q=the Google search query
-//   timeout=a timeout for the request, in time.Duration format
+//
+//	q=the Google search query
+//	timeout=a timeout for the request, in time.Duration format
+//	format=html, json or ndjson; without it the Accept header decides
+//
+// JSON responses carry the results with elapsed/timeout metadata; NDJSON
+// streams one {"result":...} line per result as soon as it is found and ends
+// with a {"summary":...} line. Errors in both modes are JSON bodies of the form
+// {"error":{"status":...,"message":...}}. A failed search also reports why
+// its context was canceled (request timeout, client disconnect, upstream
+// failure or server shutdown) in "cause", and the cancellation of every
+// scope of the request in "trace"; both are logged as well.
+// JSON 响应携带结果及耗时/超时元数据；NDJSON 在找到每个结果时立即输出一行
+// {"result":...}，最后以一行 {"summary":...} 结束。两种模式下的错误都是
+// {"error":{"status":...,"message":...}} 形式的 JSON。失败的搜索还会在 "cause" 中
+// 报告它的 context 为何被取消（请求超时、客户端断开、上游失败或服务器关闭），并在
+// "trace" 中报告请求中每个作用域的取消情况；两者也都会被记录到日志中。
 //
 // For example, http://localhost:8080/search?q=golang&timeout=1s serves the
 // first few Google search results for "golang" or a "deadline exceeded" error
 // if the timeout expires.
+//
+// Google has retired its search API, so when the USECONTEXT_INDEX environment
+// variable lists .json or .csv document files (separated like $PATH), the
+// server answers queries from local in-memory indexes instead, which works
+// offline (see testdata/docs.json). Every file becomes one source of a
+// federated search; a file name may carry its own sub-deadline, as in
+// "docs.json@200ms".
+// Google 已停用其搜索 API。若环境变量 USECONTEXT_INDEX 列出了 .json 或 .csv 文档文件
+// （像 $PATH 那样分隔），服务器就改用本地内存索引回答查询，这样离线也能运行
+// （参见 testdata/docs.json）。每个文件都是联合搜索的一个来源；文件名后可以带上
+// 该来源自己的子截止时间，例如 "docs.json@200ms"。
+//
+// Behind reverse proxies, USECONTEXT_TRUSTED_PROXIES lists the comma-separated
+// CIDRs of the proxies whose X-Forwarded-For, X-Real-IP and Forwarded headers
+// are believed when extracting the user IP.
+// 位于反向代理之后时，USECONTEXT_TRUSTED_PROXIES 以逗号分隔列出代理的 CIDR，
+// 提取用户 IP 时只相信这些代理添加的 X-Forwarded-For、X-Real-IP 和 Forwarded 头部。
+//
+// Results are cached per source for USECONTEXT_CACHE_TTL (default 1m, 0
+// disables the cache), and concurrent identical queries share one upstream
+// call. A Cache-Control: no-cache request refreshes the cache, no-store
+// bypasses it.
+// 每个来源的结果都被缓存 USECONTEXT_CACHE_TTL 时长（默认 1m，0 表示不缓存），并且并发的
+// 相同查询共享一次上游调用。带 Cache-Control: no-cache 的请求刷新缓存，no-store 则绕过缓存。
+//
+// GET /search/stream?q=golang pushes the results over Server-Sent Events as
+// the sources find them, with heartbeat comments in between, and cancels the
+// sources as soon as the client disconnects. Reconnecting with the
+// Last-Event-ID of the last result event resumes where the stream stopped.
+// GET /search/stream?q=golang 在各来源找到结果时通过 Server-Sent Events 推送结果，期间
+// 穿插心跳注释，并在客户端断开时立即取消各来源。带着最后一个结果事件的 Last-Event-ID
+// 重新连接，就会从流停止的地方继续。
+//
+// GET /metrics serves request counts, search latencies against the requested
+// timeouts, cancellations by cause and the hits and misses of the result
+// caches in the Prometheus text format.
+// GET /metrics 以 Prometheus 文本格式提供请求计数、搜索耗时与所请求超时的对比、
+// 按原因统计的取消次数，以及结果缓存的命中与未命中次数。
+//
+// Each user IP may issue USECONTEXT_RATE searches per second (default 5) with
+// bursts of USECONTEXT_BURST (default 10); excess requests get 429 Too Many
+// Requests before any upstream quota is spent.
+// 每个用户 IP 每秒可以发起 USECONTEXT_RATE 次搜索（默认 5 次），突发量为
+// USECONTEXT_BURST（默认 10）；超出的请求在消耗任何上游配额之前就得到 429 Too Many Requests。
 package usecontext
 
 import (
 	"context"
-
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"com.example/golearn/concurrent/usecontext/canceltrace"
 	"com.example/golearn/concurrent/usecontext/google"
+	"com.example/golearn/concurrent/usecontext/ratelimit"
 	"com.example/golearn/concurrent/usecontext/userip"
 )
 
+// Run serves /search on :8080 (or $USECONTEXT_ADDR) until the process is
+// interrupted, then gives in-flight searches ten seconds to finish.
+// Run 在 :8080（或 $USECONTEXT_ADDR）上提供 /search 服务，直到进程被中断，
+// 然后给进行中的搜索十秒钟时间完成。
 func Run() {
-	http.HandleFunc("/search", handleSearch)
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	opts, err := optionsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	google.DefaultBreaker.OnStateChange = logBreakerEvent
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s := NewServer(opts...)
+	if err := s.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("usecontext: listening on %s", s.Addr())
+	if err := shutdownWhenDone(ctx, s, 10*time.Second); err != nil {
+		log.Print(err)
+	}
+}
+
+// shutdownWhenDone waits for ctx and then shuts s down, giving in-flight
+// searches grace to finish. ctx only triggers the Shutdown: Start does not
+// cancel the searches with it.
+// shutdownWhenDone 等待 ctx 结束，然后关闭 s，并给进行中的搜索 grace 时长来完成。ctx 只用来
+// 触发 Shutdown：Start 并不会让搜索随它一起被取消。
+func shutdownWhenDone(ctx context.Context, s *Server, grace time.Duration) error {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// optionsFromEnv turns the USECONTEXT_* environment variables into Server options.
+// optionsFromEnv 把 USECONTEXT_* 环境变量转换为 Server 的选项。
+func optionsFromEnv() ([]Option, error) {
+	sources, err := resolveSources()
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Minute
+	if v := os.Getenv("USECONTEXT_CACHE_TTL"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("usecontext: bad USECONTEXT_CACHE_TTL: %w", err)
+		}
+	}
+	if ttl > 0 {
+		//缓存位于熔断器之外，命中缓存的查询根本不会触及上游。
+		for i := range sources {
+			sources[i].Backend = &google.Cache{Backend: sources[i].Backend, TTL: ttl}
+		}
+	}
+	clientIP, err := userip.NewExtractor(strings.Split(os.Getenv("USECONTEXT_TRUSTED_PROXIES"), ",")...)
+	if err != nil {
+		return nil, err
+	}
+	limiter, err := resolveLimiter()
+	if err != nil {
+		return nil, err
+	}
+	opts := []Option{WithSources(sources...), WithClientIP(clientIP), WithLimiter(limiter)}
+	if addr := os.Getenv("USECONTEXT_ADDR"); addr != "" {
+		opts = append(opts, WithAddr(addr))
+	}
+	return opts, nil
+}
+
+// resolveLimiter builds the per-IP rate limiter from USECONTEXT_RATE and USECONTEXT_BURST.
+// resolveLimiter 根据 USECONTEXT_RATE 与 USECONTEXT_BURST 构建按 IP 限流的限流器。
+func resolveLimiter() (*ratelimit.Limiter, error) {
+	rate, burst := 5.0, 10
+	if v := os.Getenv("USECONTEXT_RATE"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("usecontext: bad USECONTEXT_RATE: %w", err)
+		}
+		rate = r
+	}
+	if v := os.Getenv("USECONTEXT_BURST"); v != "" {
+		b, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("usecontext: bad USECONTEXT_BURST: %w", err)
+		}
+		burst = b
+	}
+	return ratelimit.NewLimiter(rate, burst), nil
+}
+
+// resolveSources returns one local index per file listed in USECONTEXT_INDEX,
+// or the Google web backend when the variable is empty. Every source sits
+// behind its own circuit breaker.
+// resolveSources 为 USECONTEXT_INDEX 中列出的每个文件返回一个本地索引来源；
+// 该变量为空时返回 Google Web 后端。每个来源都位于各自的熔断器之后。
+func resolveSources() ([]google.Source, error) {
+	list := os.Getenv("USECONTEXT_INDEX")
+	if list == "" {
+		return []google.Source{{Name: "google", Backend: google.BackendFunc(google.Search)}}, nil
+	}
+	var sources []google.Source
+	for _, spec := range filepath.SplitList(list) {
+		path, timeout := spec, time.Duration(0)
+		if i := strings.LastIndexByte(spec, '@'); i >= 0 {
+			d, err := time.ParseDuration(spec[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("usecontext: bad sub-deadline in %q: %w", spec, err)
+			}
+			path, timeout = spec[:i], d
+		}
+		ix, err := google.LoadIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("usecontext: serving %d documents from %s", ix.Len(), path)
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		breaker := google.NewBreaker(name, ix)
+		breaker.OnStateChange = logBreakerEvent
+		sources = append(sources, google.Source{Name: name, Backend: breaker, Timeout: timeout})
+	}
+	return sources, nil
+}
+
+// logBreakerEvent logs the state changes of the sources' circuit breakers.
+// logBreakerEvent 记录各来源熔断器的状态变化。
+func logBreakerEvent(ev google.BreakerEvent) {
+	if ev.Err != nil {
+		log.Printf("usecontext: breaker %s: %s -> %s after %v", ev.Name, ev.From, ev.To, ev.Err)
+		return
+	}
+	log.Printf("usecontext: breaker %s: %s -> %s", ev.Name, ev.From, ev.To)
 }
 
 // handleSearch handles URLs like /search?q=golang&timeout=1s by forwarding the
-// query to google.Search. If the query param includes timeout, the search is
+// query to every source of the Server's federation. If the query param includes timeout, the search is
 // canceled after that duration elapses.
-//handleSearch 处理器通过把查询转发给google.Search来处理诸如 /search?q=golang&timeout=1s这样的请求。
-//如果请求参数中包括timeout，那么在给定的超时时长到达后，请求就会被取消。
-func handleSearch(w http.ResponseWriter, req *http.Request) {
+// handleSearch 处理器通过把查询转发给Server联邦（federation）中的每一个来源来处理诸如 /search?q=golang&timeout=1s这样的请求。
+// 如果请求参数中包括timeout，那么在给定的超时时长到达后，请求就会被取消。
+func (s *Server) handleSearch(w http.ResponseWriter, req *http.Request) {
 	// ctx is the Context for this handler. Calling cancel closes the
 	// ctx.Done channel, which is the cancellation signal for requests
 	// started by this handler.
 	//ctx用于这个处理器。调用cancel会关闭ctx.Done channel，这是由该处理器所发起的请求的取消信号。
+	// It derives from the request's scope, so it is also canceled when
+	// the client goes away or the Server shuts down. Every scope records
+	// the cause of its cancellation in the request's canceltrace.Trace.
+	//ctx派生自请求的作用域，因此当客户端离开或者Server关闭时，它也会被取消。
+	//每个作用域都会把它被取消的原因记录到请求的 canceltrace.Trace 中。
+	reqCtx, cancelRequest := s.requestScope(req)
+	defer cancelRequest(canceltrace.ErrReturned)
 	var (
 		ctx    context.Context
-		cancel context.CancelFunc
+		cancel context.CancelCauseFunc
 	)
 	timeout, err := time.ParseDuration(req.FormValue("timeout"))
 	if err == nil {
 		// The request has a timeout, so create a context that is
 		// canceled automatically when the timeout expires.
 		//如果请求有超时限制，则创建一个context,当超时发生时自动取消该context。
-		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		ctx, cancel = canceltrace.WithTimeout(reqCtx, "search", timeout)
 	} else {
-		ctx, cancel = context.WithCancel(context.Background())
+		ctx, cancel = canceltrace.WithCancel(reqCtx, "search")
 	}
 	//handleSearch返回时立即取消ctx。
-	defer cancel() // Cancel ctx as soon as handleSearch returns.
+	defer cancel(canceltrace.ErrReturned) // Cancel ctx as soon as handleSearch returns.
+
+	// Pick HTML, JSON or NDJSON from format= or the Accept header.
+	//根据 format= 参数或 Accept 头部选择 HTML、JSON 或 NDJSON 格式。
+	f := negotiateFormat(req)
 
 	// Check the search query.
 	query := req.FormValue("q")
 	if query == "" {
-		http.Error(w, "no query", http.StatusBadRequest)
+		writeError(w, f, http.StatusBadRequest, errors.New("no query"))
 		return
 	}
 
 	// Store the user IP in ctx for use by code in other packages.
-	userIP, err := userip.FromRequest(req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	// clientIP.Middleware has usually extracted it already.
+	//用户 IP 通常已经由 clientIP.Middleware 提取并存入请求的 Context 中了。
+	userIP, ok := userip.FromContext(req.Context())
+	if !ok {
+		if userIP, err = s.clientIP.FromRequest(req); err != nil {
+			writeError(w, f, http.StatusBadRequest, err)
+			return
+		}
 	}
 	ctx = userip.NewContext(ctx, userIP)
 
-	// Run the Google search and print the results.
+	// Let Cache-Control: no-cache / no-store bypass the result caches.
+	//让 Cache-Control: no-cache / no-store 绕过结果缓存。
+	ctx = google.WithCacheMode(ctx, cacheModeFromRequest(req))
+
+	if f == formatNDJSON {
+		s.streamSearch(ctx, cancel, w, query, timeout)
+		return
+	}
+
+	// Run the search and print the results.
 	//
 	start := time.Now()
-	results, err := google.Search(ctx, query)
+	// Sources that time out or fail are reported next to the partial results.
+	//超时或失败的来源会与部分结果一起报告出来。
+	results, sources, err := s.federation.SearchReport(ctx, query)
 	elapsed := time.Since(start)
+	s.metrics.observeSearch(ctx, elapsed, timeout)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = searchFailed(ctx, cancel, query, err)
+		writeError(w, f, searchErrorStatus(w, err), err)
+		return
+	}
+	if f == formatJSON {
+		writeJSON(w, searchResponse{
+			Query:         query,
+			Results:       results,
+			searchSummary: newSearchSummary(sources, elapsed, timeout),
+		})
 		return
 	}
 	if err := resultsTemplate.Execute(w, struct {
 		Results          google.Results
+		Sources          []google.SourceReport
 		Timeout, Elapsed time.Duration
 	}{
 		Results: results,
+		Sources: sources,
 		Timeout: timeout,
 		Elapsed: elapsed,
 	}); err != nil {
@@ -90,6 +323,132 @@ func handleSearch(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// streamSearch writes each result as an NDJSON line as soon as a source finds
+// it, followed by a summary line. The status line is only sent with the first
+// result, so a search that fails before finding anything still gets a proper
+// error status.
+// streamSearch 在某个来源找到结果时立即把它写成一行 NDJSON，最后再写一行摘要。
+// 状态行只随第一个结果一起发送，因此在找到任何结果之前就失败的搜索仍然可以得到正确的错误状态码。
+func (s *Server) streamSearch(ctx context.Context, cancel context.CancelCauseFunc, w http.ResponseWriter, query string, timeout time.Duration) {
+	var nw *ndjsonWriter
+	start := time.Now()
+	sources, err := s.federation.StreamReport(ctx, query, func(r google.Result) {
+		if nw == nil {
+			nw = newNDJSONWriter(w)
+		}
+		nw.write(streamLine{Result: &r})
+	})
+	elapsed := time.Since(start)
+	s.metrics.observeSearch(ctx, elapsed, timeout)
+	if err != nil {
+		err = searchFailed(ctx, cancel, query, err)
+		if nw == nil {
+			writeError(w, formatNDJSON, searchErrorStatus(w, err), err)
+			return
+		}
+		msg := err.Error()
+		nw.write(streamLine{Error: &msg})
+		return
+	}
+	if nw == nil {
+		nw = newNDJSONWriter(w)
+	}
+	summary := newSearchSummary(sources, elapsed, timeout)
+	nw.write(streamLine{Summary: &summary})
+}
+
+// requestScope returns the root scope of a search request. It carries a new
+// canceltrace.Trace and, as it is detached from req.Context(), gets its own
+// cause when that context is done: ErrServerShutdown if the Server is
+// shutting down, ErrClientDisconnected otherwise.
+// requestScope 返回一次搜索请求的根作用域。它携带一个新的 canceltrace.Trace；由于它与
+// req.Context() 分离，在后者结束时它会得到自己的原因：Server 正在关闭时为
+// ErrServerShutdown，否则为 ErrClientDisconnected。
+func (s *Server) requestScope(req *http.Request) (context.Context, context.CancelCauseFunc) {
+	parent := req.Context()
+	ctx := canceltrace.NewContext(context.WithoutCancel(parent), canceltrace.New())
+	ctx, cancel := canceltrace.WithCancel(ctx, "request")
+	stop := context.AfterFunc(parent, func() {
+		if s.baseCtx.Err() != nil {
+			cancel(canceltrace.ErrServerShutdown)
+			return
+		}
+		cancel(canceltrace.ErrClientDisconnected)
+	})
+	return ctx, func(cause error) {
+		stop()
+		cancel(cause)
+	}
+}
+
+// searchFailure is a failed search together with why its context was
+// canceled, if it was, and the request's cancellation trace.
+// searchFailure 是一次失败的搜索，以及它的 context 被取消的原因（如果被取消了）和请求的取消跟踪。
+type searchFailure struct {
+	err   error
+	cause error
+	trace []canceltrace.Event
+}
+
+func (e *searchFailure) Error() string {
+	if e.cause == nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%v (cause: %v)", e.err, e.cause)
+}
+
+func (e *searchFailure) Unwrap() error { return e.err }
+
+// searchFailed cancels the search scope ctx, with an upstream failure as the
+// cause unless something canceled it first, logs the cancellation trace
+// and returns err annotated with the cause and trace.
+// searchFailed 取消搜索作用域 ctx：除非已有别的原因先取消了它，否则以上游失败为原因；
+// 然后记录取消跟踪，并返回附加了原因与跟踪的 err。
+func searchFailed(ctx context.Context, cancel context.CancelCauseFunc, query string, err error) error {
+	cancel(&canceltrace.UpstreamError{Err: err})
+	f := &searchFailure{err: err, cause: context.Cause(ctx)}
+	var upstream *canceltrace.UpstreamError
+	if errors.As(f.cause, &upstream) && upstream.Err == err {
+		f.cause = nil //原因就是错误本身，无需重复
+	}
+	trace := canceltrace.FromContext(ctx)
+	if trace != nil {
+		f.trace = trace.Events()
+	}
+	log.Printf("usecontext: search %q failed: %v; cancellations: %v", query, f, trace)
+	return f
+}
+
+// cacheModeFromRequest maps the Cache-Control header of req to a cache mode:
+// no-store bypasses the caches, no-cache or max-age=0 refreshes them.
+// cacheModeFromRequest 把 req 的 Cache-Control 头部映射为缓存模式：
+// no-store 绕过缓存，no-cache 或 max-age=0 刷新缓存。
+func cacheModeFromRequest(req *http.Request) google.CacheMode {
+	mode := google.CacheDefault
+	for _, directive := range strings.Split(req.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-store":
+			return google.CacheNoStore
+		case "no-cache", "max-age=0":
+			mode = google.CacheNoCache
+		}
+	}
+	return mode
+}
+
+// searchErrorStatus maps a failed search to its status code: 503 with a
+// Retry-After header when the sources' circuit breakers are open, 500 otherwise.
+// searchErrorStatus 把失败的搜索映射为状态码：来源的熔断器打开时为 503 并带有
+// Retry-After 头部，否则为 500。
+func searchErrorStatus(w http.ResponseWriter, err error) int {
+	var open *google.BreakerOpenError
+	if !errors.As(err, &open) {
+		return http.StatusInternalServerError
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(open.RetryAfter.Seconds())))))
+	return http.StatusServiceUnavailable
+}
+
 var resultsTemplate = template.Must(template.New("results").Parse(`
 <html>
 <head/>
@@ -100,6 +459,11 @@ var resultsTemplate = template.Must(template.New("results").Parse(`
   {{end}}
   </ol>
   <p>{{len .Results}} results in {{.Elapsed}}; timeout {{.Timeout}}</p>
+  <ul>
+  {{range .Sources}}
+    <li>{{.Name}}: {{.Status}}, {{.Results}} results in {{.Elapsed}}{{with .Err}} ({{.}}){{end}}</li>
+  {{end}}
+  </ul>
 </body>
 </html>
 `))
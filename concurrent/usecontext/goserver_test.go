@@ -0,0 +1,162 @@
+package usecontext
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/google"
+)
+
+// newTestIndexServer 返回一个使用 testdata 中本地索引的 Server。
+func newTestIndexServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	t.Setenv("USECONTEXT_INDEX", "testdata/docs.json"+string(filepath.ListSeparator)+"testdata/docs.csv@1s")
+	sources, err := resolveSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 || sources[0].Name != "docs" || sources[1].Timeout != time.Second {
+		t.Fatalf("resolveSources() = %+v", sources)
+	}
+	if b, ok := sources[0].Backend.(*google.Breaker); !ok {
+		t.Fatalf("source backend = %T, want *google.Breaker", sources[0].Backend)
+	} else if _, ok := b.Backend.(*google.Index); !ok {
+		t.Fatalf("breaker backend = %T, want *google.Index", b.Backend)
+	}
+	return NewServer(append([]Option{WithSources(sources...)}, opts...)...)
+}
+
+func (s *Server) search(target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleSearchWithIndex(t *testing.T) {
+	s := newTestIndexServer(t)
+	rec := s.search("/search?q=context&timeout=1s")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "https://pkg.go.dev/context") {
+		t.Errorf("body does not list the context package:\n%s", rec.Body)
+	}
+}
+
+func TestHandleSearchJSON(t *testing.T) {
+	s := newTestIndexServer(t)
+	rec := s.search("/search?q=context&timeout=1s", "Accept", "text/plain, application/json;q=0.9")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var resp searchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Query != "context" || len(resp.Results) == 0 || resp.TimeoutMS != 1000 || len(resp.Sources) != 2 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	rec = s.search("/search?format=json")
+	var body errorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q: %v", rec.Body, err)
+	}
+	if rec.Code != http.StatusBadRequest || body.Error.Status != http.StatusBadRequest || body.Error.Message != "no query" {
+		t.Errorf("status %d, error body %+v", rec.Code, body)
+	}
+}
+
+func TestHandleSearchNDJSON(t *testing.T) {
+	s := newTestIndexServer(t)
+	rec := s.search("/search?q=go+context&format=ndjson")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var results int
+	var last streamLine
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		last = streamLine{}
+		if err := json.Unmarshal(sc.Bytes(), &last); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		if last.Result != nil {
+			results++
+		}
+	}
+	if results == 0 || last.Summary == nil || len(last.Summary.Sources) != 2 {
+		t.Errorf("%d results, last line %+v", results, last)
+	}
+}
+
+func TestCacheModeFromRequest(t *testing.T) {
+	for header, want := range map[string]google.CacheMode{
+		"":                   google.CacheDefault,
+		"max-age=0":          google.CacheNoCache,
+		"No-Cache":           google.CacheNoCache,
+		"no-cache, no-store": google.CacheNoStore,
+	} {
+		req := httptest.NewRequest("GET", "/search?q=go", nil)
+		req.Header.Set("Cache-Control", header)
+		if got := cacheModeFromRequest(req); got != want {
+			t.Errorf("Cache-Control %q: mode %d, want %d", header, got, want)
+		}
+	}
+}
+
+func TestHandleSearchReportsCancelCause(t *testing.T) {
+	started := make(chan struct{}, 1)
+	broken := google.BackendFunc(func(ctx context.Context, query string) (google.Results, error) {
+		return nil, errors.New("broken pipe")
+	})
+	for _, tc := range []struct {
+		source     google.Source
+		query      string
+		cause      string
+		traceParts []string
+	}{
+		{
+			source:     google.Source{Name: "stuck", Backend: blockingBackend(started, nil)},
+			query:      "q=go&timeout=20ms",
+			cause:      "search timeout of 20ms expired",
+			traceParts: []string{"source stuck: search timeout of 20ms expired", "search: search timeout of 20ms expired"},
+		},
+		{
+			source:     google.Source{Name: "broken", Backend: broken},
+			query:      "q=go",
+			traceParts: []string{"source broken: upstream broken failure: broken pipe", "search: upstream failure: broken: broken pipe"},
+		},
+	} {
+		_, ts := NewTestServer(WithSources(tc.source))
+		resp, err := http.Get(ts.URL + "/search?format=json&" + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body errorBody
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		ts.Close()
+		if body.Error.Cause != tc.cause {
+			t.Errorf("%s: cause = %q, want %q", tc.query, body.Error.Cause, tc.cause)
+		}
+		trace := strings.Join(body.Error.Trace, "\n")
+		for _, part := range tc.traceParts {
+			if !strings.Contains(trace, part) {
+				t.Errorf("%s: trace lacks %q:\n%s", tc.query, part, trace)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package usecontext
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/canceltrace"
+	"com.example/golearn/concurrent/usecontext/google"
+	"com.example/golearn/concurrent/usecontext/metrics"
+)
+
+// Causes of a canceled search, the values of the cause label of
+// usecontext_search_cancellations_total.
+// 搜索被取消的原因，即 usecontext_search_cancellations_total 的 cause 标签的取值。
+const (
+	causeDeadline   = "deadline_exceeded" //timeout 参数到期
+	causeDisconnect = "client_disconnect" //客户端在搜索完成之前离开
+	causeShutdown   = "shutdown"          //Server 关闭时取消了仍在进行的搜索
+)
+
+// serverMetrics are the metrics a Server exports on /metrics.
+// serverMetrics 是 Server 在 /metrics 上导出的指标。
+type serverMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.CounterVec //按状态码统计的 /search 请求数
+	inFlight *metrics.Gauge      //进行中的 /search 请求数
+	elapsed  *metrics.Histogram  //搜索的耗时
+	timeout  *metrics.Histogram  //请求的 timeout 参数
+	used     *metrics.Histogram  //耗时占 timeout 的比例
+	canceled *metrics.CounterVec //按原因统计的被取消的搜索数
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		requests: r.CounterVec("usecontext_search_requests_total",
+			"Requests to /search by status code.", "code"),
+		inFlight: r.Gauge("usecontext_search_requests_in_flight",
+			"Requests to /search being served."),
+		elapsed: r.Histogram("usecontext_search_duration_seconds",
+			"Time spent searching the sources.", nil),
+		timeout: r.Histogram("usecontext_search_timeout_seconds",
+			"Timeouts requested with the timeout query param.", nil),
+		used: r.Histogram("usecontext_search_timeout_used_ratio",
+			"Search duration divided by the requested timeout; 1 means the timeout cut the search short.",
+			[]float64{.1, .25, .5, .75, .9, .99, 1}),
+		canceled: r.CounterVec("usecontext_search_cancellations_total",
+			"Searches canceled before they finished, by cause.", "cause"),
+	}
+}
+
+// exportCaches exports the counters of the result caches in front of the
+// sources, summed over all of them and read at every scrape.
+// exportCaches 导出各来源之前的结果缓存的计数器，它们是所有缓存的总和，在每次采集时读取。
+func (m *serverMetrics) exportCaches(sources []google.Source) {
+	var caches []*google.Cache
+	for _, src := range sources {
+		if c, ok := src.Backend.(*google.Cache); ok {
+			caches = append(caches, c)
+		}
+	}
+	if len(caches) == 0 {
+		return
+	}
+	sum := func(field func(google.CacheStats) int64) func() float64 {
+		return func() float64 {
+			var n int64
+			for _, c := range caches {
+				n += field(c.Stats())
+			}
+			return float64(n)
+		}
+	}
+	m.registry.CounterFunc("usecontext_cache_hits_total",
+		"Source searches answered from the result caches.", sum(func(s google.CacheStats) int64 { return s.Hits }))
+	m.registry.CounterFunc("usecontext_cache_misses_total",
+		"Source searches the result caches sent to the backends.", sum(func(s google.CacheStats) int64 { return s.Misses }))
+	m.registry.CounterFunc("usecontext_cache_coalesced_total",
+		"Source searches that waited for an identical backend call.", sum(func(s google.CacheStats) int64 { return s.Coalesced }))
+	m.registry.GaugeFunc("usecontext_cache_entries",
+		"Results held by the result caches.", sum(func(s google.CacheStats) int64 { return int64(s.Entries) }))
+}
+
+// instrument counts the requests to next by status code and the requests in flight.
+// instrument 按状态码统计发给 next 的请求数以及进行中的请求数。
+func (m *serverMetrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+		if sw.code == 0 {
+			sw.code = http.StatusOK
+		}
+		m.requests.With(strconv.Itoa(sw.code)).Inc()
+	})
+}
+
+// observeSearch records a search that ran for elapsed under ctx, given the
+// requested timeout (0 if none). It must be called before ctx is canceled by
+// the handler itself.
+// observeSearch 记录一次在 ctx 下运行了 elapsed 时长的搜索，timeout 是请求的超时时长
+// （没有则为 0）。必须在处理器自己取消 ctx 之前调用它。
+func (m *serverMetrics) observeSearch(ctx context.Context, elapsed, timeout time.Duration) {
+	m.elapsed.Observe(elapsed.Seconds())
+	if timeout > 0 {
+		m.timeout.Observe(timeout.Seconds())
+		m.used.Observe(min(elapsed.Seconds()/timeout.Seconds(), 1))
+	}
+	if cause := cancelCause(ctx); cause != "" {
+		m.canceled.With(cause).Inc()
+	}
+}
+
+// cancelCause classifies the cancel cause of ctx, or returns "" if ctx is not done.
+// cancelCause 对 ctx 的取消原因进行分类；如果 ctx 没有结束，则返回 ""。
+func cancelCause(ctx context.Context) string {
+	if ctx.Err() == nil {
+		return ""
+	}
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, canceltrace.ErrServerShutdown):
+		return causeShutdown
+	case errors.Is(cause, canceltrace.ErrClientDisconnected):
+		return causeDisconnect
+	case errors.Is(cause, context.DeadlineExceeded):
+		return causeDeadline
+	}
+	return ""
+}
+
+// statusWriter remembers the status code written through it. It keeps the
+// Flusher and Hijacker of the wrapped writer, so NDJSON streaming still works.
+// statusWriter 记住经由它写出的状态码。它保留了被包装 writer 的 Flusher 与 Hijacker，
+// 因此 NDJSON 流式输出仍然可用。
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,363 @@
+// Package metrics keeps counters, gauges and histograms and serves them in the
+// Prometheus text exposition format, without depending on the Prometheus client.
+// metrics 包维护计数器（counter）、仪表（gauge）与直方图（histogram），并以 Prometheus
+// 文本展示格式（text exposition format）提供它们，而不依赖 Prometheus 客户端库。
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suited to request latencies.
+// DefBuckets 是默认的直方图桶（单位为秒），适用于请求延迟。
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Counter is a value that only goes up.
+// Counter 是一个只增不减的值。
+type Counter struct{ v atomicFloat }
+
+// Inc adds one to the counter. Inc 把计数器加一。
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add adds v, which must not be negative, to the counter.
+// Add 把 v 加到计数器上，v 不能为负数。
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(v)
+}
+
+// Value returns the current value. Value 返回当前值。
+func (c *Counter) Value() float64 { return c.v.load() }
+
+// A Gauge is a value that goes up and down.
+// Gauge 是一个可增可减的值。
+type Gauge struct{ v atomicFloat }
+
+// Set sets the gauge to v. Set 把仪表设置为 v。
+func (g *Gauge) Set(v float64) { g.v.bits.Store(math.Float64bits(v)) }
+
+// Add adds v, which may be negative, to the gauge. Add 把 v（可以为负数）加到仪表上。
+func (g *Gauge) Add(v float64) { g.v.add(v) }
+
+// Inc adds one to the gauge. Inc 把仪表加一。
+func (g *Gauge) Inc() { g.v.add(1) }
+
+// Dec subtracts one from the gauge. Dec 把仪表减一。
+func (g *Gauge) Dec() { g.v.add(-1) }
+
+// Value returns the current value. Value 返回当前值。
+func (g *Gauge) Value() float64 { return g.v.load() }
+
+// A Histogram counts observations in buckets of increasing upper bounds.
+// Histogram 按上界递增的桶对观测值计数。
+type Histogram struct {
+	upper  []float64       //各个桶的上界，不含 +Inf
+	counts []atomic.Uint64 //每个桶（最后一个是 +Inf）的非累计计数
+	sum    atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	upper := slices.Clone(buckets)
+	slices.Sort(upper)
+	upper = slices.Compact(upper)
+	if n := len(upper); n > 0 && math.IsInf(upper[n-1], +1) {
+		upper = upper[:n-1]
+	}
+	return &Histogram{upper: upper, counts: make([]atomic.Uint64, len(upper)+1)}
+}
+
+// Observe adds v to the histogram. Observe 把 v 加入直方图。
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.upper, v) //第一个 >= v 的上界，即 v 所落入的桶
+	h.counts[i].Add(1)
+	h.sum.add(v)
+}
+
+// Count returns the number of observations. Count 返回观测的次数。
+func (h *Histogram) Count() uint64 {
+	var n uint64
+	for i := range h.counts {
+		n += h.counts[i].Load()
+	}
+	return n
+}
+
+// atomicFloat is a float64 updated with compare-and-swap on its bits.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// CounterVec is a family of counters told apart by label values.
+// CounterVec 是以标签值相区分的一族计数器。
+type CounterVec struct{ f *family }
+
+// With returns the counter of the given label values, one per label name.
+// With 返回给定标签值（与标签名一一对应）的计数器。
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	return v.f.child(labelValues, func() any { return new(Counter) }).(*Counter)
+}
+
+// family is one metric name with its HELP, TYPE and labeled children.
+type family struct {
+	name, help, typ string
+	labels          []string
+	fn              func() float64 //不为 nil 时，在每次采集时计算唯一的值
+
+	mu       sync.Mutex
+	children map[string]any //以 \xff 连接的标签值 -> *Counter、*Gauge 或 *Histogram
+}
+
+func (f *family) child(labelValues []string, create func() any) any {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.children[key]
+	if !ok {
+		c = create()
+		f.children[key] = c
+	}
+	return c
+}
+
+// A Registry holds metric families and writes them in the text exposition
+// format. Its zero value is ready to use; it is also an http.Handler for /metrics.
+// Registry 保存各族指标，并以文本展示格式输出它们。零值即可使用；它同时也是
+// /metrics 的 http.Handler。
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns an empty Registry. NewRegistry 返回一个空的 Registry。
+func NewRegistry() *Registry { return &Registry{} }
+
+// Counter registers and returns an unlabeled counter. Like the other
+// registering methods, it panics if name is invalid or already registered.
+// Counter 注册并返回一个没有标签的计数器。与其他注册方法一样，
+// name 不合法或者已被注册时它会 panic。
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+// CounterVec registers and returns a family of counters with the given label names.
+// CounterVec 注册并返回一族带有给定标签名的计数器。
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, "counter", labels, nil)}
+}
+
+// Gauge registers and returns an unlabeled gauge.
+// Gauge 注册并返回一个没有标签的仪表。
+func (r *Registry) Gauge(name, help string) *Gauge {
+	f := r.register(name, help, "gauge", nil, nil)
+	return f.child(nil, func() any { return new(Gauge) }).(*Gauge)
+}
+
+// GaugeFunc registers a gauge whose value is computed by fn at every scrape.
+// GaugeFunc 注册一个仪表，它的值在每次采集时由 fn 计算。
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, help, "gauge", nil, fn)
+}
+
+// CounterFunc registers a counter whose value is computed by fn at every
+// scrape, for counts kept elsewhere such as a cache's hit counter.
+// CounterFunc 注册一个计数器，它的值在每次采集时由 fn 计算，适用于在别处维护的计数，
+// 例如缓存的命中计数。
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, help, "counter", nil, fn)
+}
+
+// Histogram registers and returns an unlabeled histogram; nil buckets means DefBuckets.
+// Histogram 注册并返回一个没有标签的直方图；buckets 为 nil 表示使用 DefBuckets。
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	f := r.register(name, help, "histogram", nil, nil)
+	return f.child(nil, func() any { return newHistogram(buckets) }).(*Histogram)
+}
+
+func (r *Registry) register(name, help, typ string, labels []string, fn func() float64) *family {
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, l := range labels {
+		if !validName(l) || strings.Contains(l, ":") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metrics: %s registered twice", name))
+		}
+	}
+	f := &family{name: name, help: help, typ: typ, labels: labels, fn: fn, children: make(map[string]any)}
+	r.families = append(r.families, f)
+	return f
+}
+
+// WriteTo writes every family, sorted by name, in the text exposition format.
+// WriteTo 以文本展示格式输出按名称排序的所有指标族。
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+	slices.SortFunc(families, func(a, b *family) int { return strings.Compare(a.name, b.name) })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper.
+// ServeHTTP 把指标提供给 Prometheus 的采集器。
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+func (f *family) write(w *bufio.Writer) {
+	if f.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	if f.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+		return
+	}
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	children := make([]any, len(keys))
+	for i, k := range keys {
+		children[i] = f.children[k]
+	}
+	f.mu.Unlock()
+
+	for i, c := range children {
+		var values []string
+		if len(f.labels) > 0 {
+			values = strings.Split(keys[i], "\xff")
+		}
+		switch c := c.(type) {
+		case *Counter:
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labelPairs(f.labels, values, ""), formatFloat(c.Value()))
+		case *Gauge:
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labelPairs(f.labels, values, ""), formatFloat(c.Value()))
+		case *Histogram:
+			var cumulative uint64
+			for j := range c.counts {
+				cumulative += c.counts[j].Load()
+				le := "+Inf"
+				if j < len(c.upper) {
+					le = formatFloat(c.upper[j])
+				}
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, values, le), cumulative)
+			}
+			//_count 取自累计值，使它与 +Inf 桶始终一致。
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labelPairs(f.labels, values, ""), formatFloat(c.sum.load()))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, labelPairs(f.labels, values, ""), cumulative)
+		}
+	}
+}
+
+// labelPairs formats {name="value",...}, with le appended for histogram buckets.
+func labelPairs(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if le != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=\"%s\"", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// validName reports whether s matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c == ':' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.CounterVec("requests_total", "Requests by code.", "code")
+	requests.With("200").Add(3)
+	requests.With("500").Inc()
+	r.Gauge("in_flight", "").Set(2)
+	h := r.Histogram("duration_seconds", "Latency\nin seconds.", []float64{1, 0.5})
+	for _, v := range []float64{0.2, 0.5, 0.7, 3} {
+		h.Observe(v)
+	}
+	r.CounterFunc("hits_total", `Cache "hits".`, func() float64 { return 7 })
+	r.CounterVec("labels_total", "", "v").With("a\"b\\c\nd").Inc()
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP duration_seconds Latency\nin seconds.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.5"} 2
+duration_seconds_bucket{le="1"} 3
+duration_seconds_bucket{le="+Inf"} 4
+duration_seconds_sum 4.4
+duration_seconds_count 4
+# HELP hits_total Cache "hits".
+# TYPE hits_total counter
+hits_total 7
+# TYPE in_flight gauge
+in_flight 2
+# TYPE labels_total counter
+labels_total{v="a\"b\\c\nd"} 1
+# HELP requests_total Requests by code.
+# TYPE requests_total counter
+requests_total{code="200"} 3
+requests_total{code="500"} 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("dup", "")
+	for name, register := range map[string]func(){
+		"duplicate":   func() { r.Gauge("dup", "") },
+		"bad name":    func() { r.Counter("1bad", "") },
+		"le label":    func() { r.CounterVec("h", "", "le") },
+		"label arity": func() { r.CounterVec("c", "", "a", "b").With("x") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	r := NewRegistry()
+	c := r.CounterVec("c_total", "", "k")
+	h := r.Histogram("h", "", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.With("x").Inc()
+				h.Observe(0.01)
+			}
+			r.WriteTo(new(strings.Builder))
+		}()
+	}
+	wg.Wait()
+	if v := c.With("x").Value(); v != 8000 {
+		t.Errorf("counter = %v, want 8000", v)
+	}
+	if n := h.Count(); n != 8000 {
+		t.Errorf("histogram count = %d, want 8000", n)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("up", "").Inc()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "up 1\n") {
+		t.Errorf("body = %s", w.Body)
+	}
+}
@@ -0,0 +1,101 @@
+package usecontext
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/google"
+)
+
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestMetricsCountRequestsAndCancellations(t *testing.T) {
+	started := make(chan struct{}, 2)
+	_, ts := NewTestServer(WithSources(google.Source{Name: "stuck", Backend: blockingBackend(started, nil)}))
+	defer ts.Close()
+
+	//timeout 参数让搜索被截止时间截断。
+	resp, err := http.Get(ts.URL + "/search?q=go&timeout=20ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	//客户端在搜索完成之前离开。
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/search?q=go&format=ndjson", nil)
+	chDone := make(chan struct{})
+	go func() {
+		defer close(chDone)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	<-started
+	cancel()
+	<-chDone
+
+	want := []string{
+		`usecontext_search_requests_total{code="500"} 2`, //断开连接的客户端也会得到 500
+		`usecontext_search_cancellations_total{cause="deadline_exceeded"} 1`,
+		`usecontext_search_cancellations_total{cause="client_disconnect"} 1`,
+		`usecontext_search_timeout_used_ratio_bucket{le="0.99"} 0`,
+		`usecontext_search_timeout_used_ratio_bucket{le="1"} 1`,
+		`usecontext_search_timeout_seconds_count 1`,
+		`usecontext_search_duration_seconds_count 2`,
+		`usecontext_search_requests_in_flight 0`,
+	}
+	//处理器在客户端离开之后才记录指标，因此要等一会儿。
+	var body string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if body = scrape(t, ts.URL); strings.Contains(body, "client_disconnect") {
+			break
+		}
+	}
+	for _, line := range want {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("/metrics lacks %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsExportCacheStats(t *testing.T) {
+	backend := google.BackendFunc(func(context.Context, string) (google.Results, error) {
+		return google.Results{{Title: "Go", URL: "https://go.dev/"}}, nil
+	})
+	cache := &google.Cache{Backend: backend, TTL: time.Minute}
+	_, ts := NewTestServer(WithSources(google.Source{Name: "cached", Backend: cache}))
+	defer ts.Close()
+	for _, q := range []string{"go", "go", "go", "context"} {
+		resp, err := http.Get(ts.URL + "/search?q=" + q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	body := scrape(t, ts.URL)
+	for _, line := range []string{
+		"usecontext_cache_hits_total 2",
+		"usecontext_cache_misses_total 2",
+		"usecontext_cache_coalesced_total 0",
+		"usecontext_cache_entries 2",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("/metrics lacks %q:\n%s", line, body)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package usecontext
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
 	"time"
 )
 
@@ -10,6 +14,14 @@ import (
 //
 // Context's methods may be called by multiple goroutines simultaneously.
 // Context的方法可以被多个例程（goroutines）同时调用。
+//
+// MyContext has exactly the methods of context.Context, so the two are
+// interchangeable: a context.Context can be the parent of the contexts made
+// by the constructors in this file, and a MyContext can be passed to any
+// function that takes a context.Context.
+// MyContext 的方法与 context.Context 完全相同，因此两者可以互换：context.Context
+// 可以作为本文件中各构造函数所创建上下文的父上下文，MyContext 也可以传给任何接受
+// context.Context 的函数。
 type MyContext interface {
 	// Deadline returns the time when work done on behalf of this context
 	// should be canceled. Deadline returns ok==false when no deadline is
@@ -60,6 +72,459 @@ type MyContext interface {
 	//见https://blog.golang.org/pipelines 以获得更多关于如何使用Done 通道用于取消操作的的例子。
 	Done() <-chan struct{}
 
+	// If Done is not yet closed, Err returns nil.
+	// If Done is closed, Err returns a non-nil error explaining why:
+	// Canceled if the context was canceled
+	// or DeadlineExceeded if the context's deadline passed.
+	// After Err returns a non-nil error, successive calls to Err return the same error.
+	// 如果Done通道尚未关闭，Err返回nil。如果Done已经关闭，Err返回一个非nil的错误来说明原因：
+	// 上下文被取消时返回Canceled，上下文的截止时间已过时返回DeadlineExceeded。
+	// 一旦Err返回了非nil的错误，后续对Err的调用都返回同一个错误。
+	Err() error
+
+	// Value returns the value associated with this context for key, or nil
+	// if no value is associated with key. Successive calls to Value with
+	// the same key returns the same result.
+	// Value返回该上下文中与key相关联的值，如果没有与key相关联的值则返回nil。
+	// 用同一个key连续调用Value会返回相同的结果。
+	//
+	// Use context values only for request-scoped data that transits
+	// processes and API boundaries, not for passing optional parameters to
+	// functions.
+	// 上下文的值只用于穿过进程与API边界的请求范围（request-scoped）的数据，
+	// 而不要用来向函数传递可选参数。
+	Value(key any) any
+}
+
+// Canceled is the error returned by MyContext.Err when the context is canceled.
+// It is the same value as context.Canceled, so errors.Is works across both implementations.
+// Canceled 是上下文被取消时 MyContext.Err 返回的错误。它与 context.Canceled 是同一个值，
+// 因此 errors.Is 在两种实现之间都适用。
+var Canceled = context.Canceled
+
+// DeadlineExceeded is the error returned by MyContext.Err when the context's
+// deadline passes. It is the same value as context.DeadlineExceeded.
+// DeadlineExceeded 是上下文的截止时间已过时 MyContext.Err 返回的错误，
+// 它与 context.DeadlineExceeded 是同一个值。
+var DeadlineExceeded = context.DeadlineExceeded
+
+// A CancelFunc tells an operation to abandon its work. It does not wait for
+// the work to stop and may be called by multiple goroutines; after the first
+// call, subsequent calls do nothing.
+// CancelFunc 通知一个操作放弃它的工作。它不等待工作停止，可以被多个例程同时调用；
+// 第一次调用之后，后续的调用什么也不做。
+type CancelFunc func()
+
+// A CancelCauseFunc behaves like a CancelFunc but additionally sets the
+// cancellation cause, which Cause returns.
+// CancelCauseFunc 的行为与 CancelFunc 相同，但还会设置取消原因，Cause 函数会返回该原因。
+type CancelCauseFunc func(cause error)
+
+// emptyCtx is never canceled, has no values, and has no deadline.
+// emptyCtx 永远不会被取消，没有值，也没有截止时间。
+type emptyCtx struct{ name string }
+
+func (emptyCtx) Deadline() (deadline time.Time, ok bool) { return }
+func (emptyCtx) Done() <-chan struct{}                   { return nil }
+func (emptyCtx) Err() error                              { return nil }
+func (emptyCtx) Value(key any) any                       { return nil }
+func (e emptyCtx) String() string                        { return e.name }
+
+var (
+	background MyContext = emptyCtx{"usecontext.Background"}
+	todo       MyContext = emptyCtx{"usecontext.TODO"}
+)
+
+// Background returns a non-nil, empty MyContext. It is never canceled, has no
+// values, and has no deadline; it is the root of a tree of contexts.
+// Background 返回一个非nil的空 MyContext。它永远不会被取消，没有值，也没有截止时间，
+// 是上下文树的根。
+func Background() MyContext { return background }
+
+// TODO returns a non-nil, empty MyContext, for code where it is unclear which
+// context to use yet.
+// TODO 返回一个非nil的空 MyContext，用于还不清楚该使用哪个上下文的代码。
+func TODO() MyContext { return todo }
+
+// A canceler is a context that can be canceled directly: a *cancelCtx,
+// *timerCtx or *afterFuncCtx.
+// canceler 是可以被直接取消的上下文：*cancelCtx、*timerCtx 或 *afterFuncCtx。
+type canceler interface {
+	cancel(removeFromParent bool, err, cause error)
+	Done() <-chan struct{}
+}
+
+// cancelCtxKey is the key that a cancelCtx returns itself for.
+// cancelCtx 在以 cancelCtxKey 为键调用 Value 时返回它自己。
+var cancelCtxKey int
+
+// A cancelCtx can be canceled. When canceled, it also cancels any children
+// that implement canceler and detaches itself from its parent.
+// cancelCtx 可以被取消。被取消时，它也取消所有实现了 canceler 的子上下文，
+// 并把自己从父上下文中摘除。
+type cancelCtx struct {
+	MyContext // parent 父上下文
+
+	mu       sync.Mutex            // protects following fields 保护下面的字段
+	done     chan struct{}         // closed by the first cancel call 由第一次 cancel 调用关闭
+	children map[canceler]struct{} // set to nil by the first cancel call 由第一次 cancel 调用置为 nil
+	err      error                 // set to non-nil by the first cancel call 由第一次 cancel 调用置为非nil
+	cause    error                 // set to non-nil by the first cancel call 由第一次 cancel 调用置为非nil
+}
+
+// WithCancel returns a copy of parent with a new Done channel, which is closed
+// when cancel is called or when the parent's Done channel is closed, whichever
+// happens first. Canceling releases the resources of the context, so call
+// cancel as soon as the work running in it completes.
+// WithCancel 返回 parent 的一个带有新 Done 通道的副本，当 cancel 被调用或者父上下文的
+// Done 通道被关闭时（以先发生者为准），该通道就被关闭。取消会释放上下文的资源，
+// 因此在其中运行的工作一完成就应调用 cancel。
+func WithCancel(parent MyContext) (ctx MyContext, cancel CancelFunc) {
+	c := withCancel(parent)
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithCancelCause behaves like WithCancel but returns a CancelCauseFunc;
+// Cause(ctx) then returns the error it was called with, while ctx.Err() is
+// still Canceled. A nil cause means Canceled.
+// WithCancelCause 的行为与 WithCancel 相同，但返回 CancelCauseFunc；之后 Cause(ctx)
+// 返回调用它时传入的错误，而 ctx.Err() 仍然是 Canceled。cause 为 nil 时表示 Canceled。
+func WithCancelCause(parent MyContext) (ctx MyContext, cancel CancelCauseFunc) {
+	c := withCancel(parent)
+	return c, func(cause error) { c.cancel(true, Canceled, cause) }
 }
 
+func withCancel(parent MyContext) *cancelCtx {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	c := &cancelCtx{}
+	c.init(parent, c)
+	return c
+}
+
+// init links c, embedded in self, to parent.
+// init 把嵌入在 self 中的 c 链接到 parent 上。
+func (c *cancelCtx) init(parent MyContext, self canceler) {
+	c.MyContext = parent
+	c.done = make(chan struct{})
+	propagateCancel(parent, self)
+}
+
+// propagateCancel arranges for child to be canceled when parent is.
+// propagateCancel 安排在 parent 被取消时取消 child。
+func propagateCancel(parent MyContext, child canceler) {
+	done := parent.Done()
+	if done == nil {
+		return // parent is never canceled 父上下文永远不会被取消
+	}
+	select {
+	case <-done:
+		// parent is already canceled 父上下文已经被取消了
+		child.cancel(false, parent.Err(), Cause(parent))
+		return
+	default:
+	}
+	if p, ok := parentCancelCtx(parent); ok {
+		p.mu.Lock()
+		if p.err != nil {
+			// parent has already been canceled 父上下文已经被取消了
+			child.cancel(false, p.err, p.cause)
+		} else {
+			if p.children == nil {
+				p.children = make(map[canceler]struct{})
+			}
+			p.children[child] = struct{}{}
+		}
+		p.mu.Unlock()
+		return
+	}
+	// The parent is a foreign context, such as one from the standard
+	// library: watch it from a goroutine that ends with either of the two.
+	//父上下文是外来的上下文（例如标准库的上下文）：用一个例程监视它，
+	//父子两者之一结束时该例程就结束。
+	go func() {
+		select {
+		case <-done:
+			child.cancel(false, parent.Err(), Cause(parent))
+		case <-child.Done():
+		}
+	}()
+}
+
+// parentCancelCtx returns the nearest *cancelCtx of parent, unless a
+// foreign context wrapping it has replaced its Done channel.
+// parentCancelCtx 返回 parent 最近的 *cancelCtx，除非某个包装了它的外来上下文
+// 替换了它的 Done 通道。
+func parentCancelCtx(parent MyContext) (*cancelCtx, bool) {
+	p, ok := parent.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok || p.done != parent.Done() {
+		return nil, false
+	}
+	return p, true
+}
+
+// removeChild removes a context from its parent.
+// removeChild 把一个上下文从它的父上下文中移除。
+func removeChild(parent MyContext, child canceler) {
+	p, ok := parentCancelCtx(parent)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	if p.children != nil {
+		delete(p.children, child)
+	}
+	p.mu.Unlock()
+}
+
+func (c *cancelCtx) Value(key any) any {
+	if key == &cancelCtxKey {
+		return c
+	}
+	return c.MyContext.Value(key)
+}
+
+func (c *cancelCtx) Done() <-chan struct{} { return c.done }
+
+func (c *cancelCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
 
+func (c *cancelCtx) String() string { return contextName(c.MyContext) + ".WithCancel" }
+
+// cancel closes c.done, cancels each of c's children and, if
+// removeFromParent is true, removes c from its parent's children. The
+// cause defaults to err.
+// cancel 关闭 c.done，取消 c 的每个子上下文；如果 removeFromParent 为 true，
+// 还会把 c 从父上下文的子上下文中移除。cause 默认为 err。
+func (c *cancelCtx) cancel(removeFromParent bool, err, cause error) {
+	if err == nil {
+		panic("usecontext: internal error: missing cancel error")
+	}
+	if cause == nil {
+		cause = err
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return // already canceled 已经被取消了
+	}
+	c.err, c.cause = err, cause
+	close(c.done)
+	for child := range c.children {
+		// NOTE: acquiring the child's lock while holding parent's lock.
+		//注意：在持有父上下文的锁时获取子上下文的锁。
+		child.cancel(false, err, cause)
+	}
+	c.children = nil
+	c.mu.Unlock()
+
+	if removeFromParent {
+		removeChild(c.MyContext, c)
+	}
+}
+
+// Cause returns a non-nil error explaining why c was canceled: the cause
+// given to the CancelCauseFunc of c or of one of its ancestors, otherwise
+// c.Err(). It returns nil while c is not canceled. Unlike context.Cause, it
+// also understands the contexts made in this file.
+// Cause 返回一个非nil的错误来说明 c 为何被取消：传给 c 或其某个祖先的 CancelCauseFunc
+// 的原因，否则为 c.Err()。c 尚未被取消时返回 nil。与 context.Cause 不同，
+// 它也能理解本文件中创建的上下文。
+func Cause(c MyContext) error {
+	cc, ok := c.Value(&cancelCtxKey).(*cancelCtx)
+	if !ok {
+		return context.Cause(c)
+	}
+	if c.Err() == nil {
+		return nil
+	}
+	cc.mu.Lock()
+	cause := cc.cause
+	cc.mu.Unlock()
+	if cc.done == c.Done() {
+		return cause // c is cc, or only adds values to it；c 就是 cc，或者只是在它之上添加了值
+	}
+	// A foreign context sits between c and cc. The standard library cannot
+	// see cc's cause, so use it when the foreign context has none of its own.
+	//c 与 cc 之间有一个外来的上下文。标准库看不到 cc 的原因，因此当外来上下文自己
+	//没有原因时就使用 cc 的原因。
+	if stdCause := context.Cause(c); stdCause != c.Err() || cause == nil {
+		return stdCause
+	}
+	return cause
+}
+
+// A timerCtx is a cancelCtx that is also canceled when its deadline passes.
+// timerCtx 是一个在截止时间到达时也会被取消的 cancelCtx。
+type timerCtx struct {
+	cancelCtx
+	timer *time.Timer // under cancelCtx.mu 受 cancelCtx.mu 保护
+
+	deadline time.Time
+}
+
+// WithDeadline returns a copy of parent whose deadline is no later than d.
+// If the parent's deadline is already earlier than d, it is equivalent to
+// WithCancel(parent). The Done channel is closed when the deadline expires,
+// when cancel is called, or when the parent's Done channel is closed,
+// whichever happens first.
+// WithDeadline 返回 parent 的一个截止时间不晚于 d 的副本。如果父上下文的截止时间已经
+// 早于 d，它就等价于 WithCancel(parent)。截止时间到达、cancel 被调用或者父上下文的
+// Done 通道被关闭时（以先发生者为准），Done 通道就被关闭。
+func WithDeadline(parent MyContext, d time.Time) (MyContext, CancelFunc) {
+	return WithDeadlineCause(parent, d, nil)
+}
+
+// WithDeadlineCause behaves like WithDeadline but also sets the cause that
+// Cause returns when the deadline is exceeded.
+// WithDeadlineCause 的行为与 WithDeadline 相同，但还设置了截止时间到达时 Cause 返回的原因。
+func WithDeadlineCause(parent MyContext, d time.Time, cause error) (MyContext, CancelFunc) {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	if cur, ok := parent.Deadline(); ok && cur.Before(d) {
+		// The current deadline is already sooner than the new one.
+		//当前的截止时间已经早于新的截止时间了。
+		return WithCancel(parent)
+	}
+	c := &timerCtx{deadline: d}
+	c.init(parent, c)
+	dur := time.Until(d)
+	if dur <= 0 {
+		c.cancel(true, DeadlineExceeded, cause) // deadline has already passed 截止时间已经过去了
+		return c, func() { c.cancel(false, Canceled, nil) }
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.timer = time.AfterFunc(dur, func() {
+			c.cancel(true, DeadlineExceeded, cause)
+		})
+	}
+	return c, func() { c.cancel(true, Canceled, nil) }
+}
+
+// WithTimeout returns WithDeadline(parent, time.Now().Add(timeout)).
+// WithTimeout 返回 WithDeadline(parent, time.Now().Add(timeout))。
+func WithTimeout(parent MyContext, timeout time.Duration) (MyContext, CancelFunc) {
+	return WithDeadline(parent, time.Now().Add(timeout))
+}
+
+// WithTimeoutCause behaves like WithTimeout but also sets the cause that
+// Cause returns when the timeout expires.
+// WithTimeoutCause 的行为与 WithTimeout 相同，但还设置了超时发生时 Cause 返回的原因。
+func WithTimeoutCause(parent MyContext, timeout time.Duration, cause error) (MyContext, CancelFunc) {
+	return WithDeadlineCause(parent, time.Now().Add(timeout), cause)
+}
+
+func (c *timerCtx) Deadline() (deadline time.Time, ok bool) { return c.deadline, true }
+
+func (c *timerCtx) String() string {
+	return contextName(c.cancelCtx.MyContext) + ".WithDeadline(" + c.deadline.String() + ")"
+}
+
+func (c *timerCtx) cancel(removeFromParent bool, err, cause error) {
+	c.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		// Remove this timerCtx from its parent cancelCtx's children.
+		//把这个 timerCtx 从父 cancelCtx 的子上下文中移除。
+		removeChild(c.cancelCtx.MyContext, c)
+	}
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+}
+
+// A valueCtx carries a key-value pair. It delegates all other calls to the
+// embedded MyContext.
+// valueCtx 携带一个键值对，其他调用都委托给嵌入的 MyContext。
+type valueCtx struct {
+	MyContext
+	key, val any
+}
+
+// WithValue returns a copy of parent in which the value associated with key
+// is val. The key must be comparable and should not be of a built-in type,
+// to avoid collisions between packages.
+// WithValue 返回 parent 的一个副本，其中与 key 相关联的值为 val。key 必须是可比较的，
+// 并且不应是内置类型，以免在不同的包之间发生冲突。
+func WithValue(parent MyContext, key, val any) MyContext {
+	if parent == nil {
+		panic("cannot create context from nil parent")
+	}
+	if key == nil {
+		panic("nil key")
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		panic("key is not comparable")
+	}
+	return &valueCtx{parent, key, val}
+}
+
+func (c *valueCtx) Value(key any) any {
+	if c.key == key {
+		return c.val
+	}
+	return c.MyContext.Value(key)
+}
+
+func (c *valueCtx) String() string {
+	return fmt.Sprintf("%s.WithValue(%v, %v)", contextName(c.MyContext), c.key, c.val)
+}
+
+// An afterFuncCtx is a cancelCtx whose cancellation runs f once, in its own
+// goroutine, unless stop got there first.
+// afterFuncCtx 是一个 cancelCtx，它被取消时会在单独的例程中运行一次 f，除非 stop 抢先一步。
+type afterFuncCtx struct {
+	cancelCtx
+	once sync.Once // either starts running f or stops f from running 要么开始运行 f，要么阻止 f 运行
+	f    func()
+}
+
+// AfterFunc arranges to call f in its own goroutine after ctx is canceled.
+// If ctx is already canceled, f is called immediately in its own goroutine.
+// Calling stop breaks the association of ctx with f; it returns true if that
+// stopped f from being run, and false if f has already been started or stop
+// was already called.
+// AfterFunc 安排在 ctx 被取消后在单独的例程中调用 f。如果 ctx 已经被取消，就立即在单独的
+// 例程中调用 f。调用 stop 会解除 ctx 与 f 的关联：如果这阻止了 f 的运行，stop 返回 true；
+// 如果 f 已经开始运行或者 stop 已经被调用过，则返回 false。
+func AfterFunc(ctx MyContext, f func()) (stop func() bool) {
+	a := &afterFuncCtx{f: f}
+	a.init(ctx, a)
+	return func() bool {
+		stopped := false
+		a.once.Do(func() {
+			stopped = true
+		})
+		if stopped {
+			a.cancel(true, Canceled, nil)
+		}
+		return stopped
+	}
+}
+
+func (a *afterFuncCtx) cancel(removeFromParent bool, err, cause error) {
+	a.cancelCtx.cancel(false, err, cause)
+	if removeFromParent {
+		removeChild(a.MyContext, a)
+	}
+	a.once.Do(func() {
+		go a.f()
+	})
+}
+
+// contextName names c for the String methods above.
+func contextName(c MyContext) string {
+	if s, ok := c.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return reflect.TypeOf(c).String()
+}
@@ -0,0 +1,371 @@
+package usecontext
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// contextImpl 是一套上下文的实现，一致性测试对标准库与本包的实现运行同样的用例。
+type contextImpl struct {
+	name            string
+	background      func() MyContext
+	withCancel      func(MyContext) (MyContext, func())
+	withCancelCause func(MyContext) (MyContext, func(error))
+	withDeadline    func(MyContext, time.Time) (MyContext, func())
+	withTimeout     func(MyContext, time.Duration) (MyContext, func())
+	withValue       func(MyContext, any, any) MyContext
+	afterFunc       func(MyContext, func()) func() bool
+	cause           func(MyContext) error
+}
+
+var contextImpls = []contextImpl{
+	{
+		name:       "std",
+		background: func() MyContext { return context.Background() },
+		withCancel: func(p MyContext) (MyContext, func()) {
+			return context.WithCancel(p)
+		},
+		withCancelCause: func(p MyContext) (MyContext, func(error)) {
+			return context.WithCancelCause(p)
+		},
+		withDeadline: func(p MyContext, d time.Time) (MyContext, func()) {
+			return context.WithDeadline(p, d)
+		},
+		withTimeout: func(p MyContext, d time.Duration) (MyContext, func()) {
+			return context.WithTimeout(p, d)
+		},
+		withValue: func(p MyContext, k, v any) MyContext { return context.WithValue(p, k, v) },
+		afterFunc: func(c MyContext, f func()) func() bool { return context.AfterFunc(c, f) },
+		cause:     func(c MyContext) error { return context.Cause(c) },
+	},
+	{
+		name:       "my",
+		background: Background,
+		withCancel: func(p MyContext) (MyContext, func()) {
+			return WithCancel(p)
+		},
+		withCancelCause: func(p MyContext) (MyContext, func(error)) {
+			return WithCancelCause(p)
+		},
+		withDeadline: func(p MyContext, d time.Time) (MyContext, func()) {
+			return WithDeadline(p, d)
+		},
+		withTimeout: func(p MyContext, d time.Duration) (MyContext, func()) {
+			return WithTimeout(p, d)
+		},
+		withValue: WithValue,
+		afterFunc: func(c MyContext, f func()) func() bool { return AfterFunc(c, f) },
+		cause:     Cause,
+	},
+}
+
+// forEachImpl 对每一种实现运行 test。
+func forEachImpl(t *testing.T, test func(t *testing.T, impl contextImpl)) {
+	for _, impl := range contextImpls {
+		t.Run(impl.name, func(t *testing.T) { test(t, impl) })
+	}
+}
+
+func isDone(c MyContext) bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// waitDone 等待 c 结束；对外来父上下文的传播是异步的。
+func waitDone(t *testing.T, c MyContext) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not done after 1s")
+	}
+}
+
+func TestContextBackground(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		c := impl.background()
+		if _, ok := c.Deadline(); ok {
+			t.Error("Background has a deadline")
+		}
+		if c.Done() != nil || c.Err() != nil || c.Value("k") != nil || impl.cause(c) != nil {
+			t.Error("Background is not empty")
+		}
+	})
+}
+
+func TestContextWithCancel(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		c, cancel := impl.withCancel(impl.background())
+		if isDone(c) || c.Err() != nil {
+			t.Fatal("new context is done")
+		}
+		if c.Done() != c.Done() {
+			t.Error("Done returns different channels")
+		}
+		cancel()
+		cancel() //重复调用什么也不做
+		if !isDone(c) || c.Err() != context.Canceled || impl.cause(c) != context.Canceled {
+			t.Errorf("after cancel: done %v, err %v, cause %v", isDone(c), c.Err(), impl.cause(c))
+		}
+	})
+}
+
+func TestContextPropagation(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		parent, cancelParent := impl.withCancel(impl.background())
+		child, cancelChild := impl.withCancel(parent)
+		defer cancelChild()
+		grandchild := impl.withValue(child, "k", "v")
+		grandchild, cancelGrandchild := impl.withTimeout(grandchild, time.Hour)
+		defer cancelGrandchild()
+		sibling, cancelSibling := impl.withCancel(parent)
+
+		cancelSibling()
+		if !isDone(sibling) || isDone(parent) || isDone(child) {
+			t.Fatal("canceling a child canceled its parent or sibling")
+		}
+		cancelParent()
+		for _, c := range []MyContext{child, grandchild} {
+			if !isDone(c) || c.Err() != context.Canceled {
+				t.Errorf("%v: err %v after the root was canceled", c, c.Err())
+			}
+		}
+		late, cancelLate := impl.withCancel(parent)
+		defer cancelLate()
+		if !isDone(late) {
+			t.Error("child of a canceled parent is not done")
+		}
+	})
+}
+
+func TestContextWithDeadline(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		d := time.Now().Add(20 * time.Millisecond)
+		c, cancel := impl.withDeadline(impl.background(), d)
+		defer cancel()
+		if got, ok := c.Deadline(); !ok || !got.Equal(d) {
+			t.Errorf("Deadline = %v, %v", got, ok)
+		}
+		//子上下文不能把截止时间推迟到父上下文之后。
+		child, cancelChild := impl.withDeadline(c, d.Add(time.Hour))
+		defer cancelChild()
+		if got, _ := child.Deadline(); !got.Equal(d) {
+			t.Errorf("child Deadline = %v, want the parent's %v", got, d)
+		}
+		waitDone(t, child)
+		if c.Err() != context.DeadlineExceeded || child.Err() != context.DeadlineExceeded {
+			t.Errorf("err = %v, child err = %v", c.Err(), child.Err())
+		}
+		var te interface{ Timeout() bool }
+		if !errors.As(c.Err(), &te) || !te.Timeout() {
+			t.Error("DeadlineExceeded is not a timeout")
+		}
+
+		past, cancelPast := impl.withDeadline(impl.background(), time.Now().Add(-time.Second))
+		defer cancelPast()
+		if !isDone(past) || past.Err() != context.DeadlineExceeded {
+			t.Errorf("past deadline: err %v", past.Err())
+		}
+	})
+}
+
+func TestContextCancelBeforeTimeout(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		c, cancel := impl.withTimeout(impl.background(), time.Hour)
+		cancel()
+		if c.Err() != context.Canceled {
+			t.Errorf("err = %v, want Canceled", c.Err())
+		}
+	})
+}
+
+type ctxKey string
+
+func TestContextWithValue(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		c := impl.withValue(impl.background(), ctxKey("a"), 1)
+		c, cancel := impl.withCancel(c)
+		defer cancel()
+		c = impl.withValue(c, ctxKey("b"), 2)
+		shadow := impl.withValue(c, ctxKey("a"), 3)
+		if c.Value(ctxKey("a")) != 1 || c.Value(ctxKey("b")) != 2 || shadow.Value(ctxKey("a")) != 3 {
+			t.Errorf("values a=%v b=%v shadowed a=%v", c.Value(ctxKey("a")), c.Value(ctxKey("b")), shadow.Value(ctxKey("a")))
+		}
+		if c.Value("a") != nil || c.Value(ctxKey("missing")) != nil {
+			t.Error("lookup of an unknown key is not nil")
+		}
+		for _, key := range []any{nil, []int{1}} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("WithValue(%v) did not panic", key)
+					}
+				}()
+				impl.withValue(c, key, 1)
+			}()
+		}
+	})
+}
+
+func TestContextWithCancelCause(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		errBoom := errors.New("boom")
+		parent, cancel := impl.withCancelCause(impl.background())
+		child, cancelChild := impl.withCancel(parent)
+		defer cancelChild()
+		if impl.cause(parent) != nil {
+			t.Error("cause before cancel is not nil")
+		}
+		cancel(errBoom)
+		cancel(errors.New("later")) //第一次的原因胜出
+		if parent.Err() != context.Canceled || impl.cause(parent) != errBoom || impl.cause(child) != errBoom {
+			t.Errorf("err %v, cause %v, child cause %v", parent.Err(), impl.cause(parent), impl.cause(child))
+		}
+
+		c, cancel := impl.withCancelCause(impl.background())
+		cancel(nil)
+		if impl.cause(c) != context.Canceled {
+			t.Errorf("nil cause: Cause = %v, want Canceled", impl.cause(c))
+		}
+	})
+}
+
+func TestContextAfterFunc(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		c, cancel := impl.withCancel(impl.background())
+		ran := make(chan struct{})
+		impl.afterFunc(c, func() { close(ran) })
+		stopped := make(chan struct{}, 1)
+		stop := impl.afterFunc(c, func() { stopped <- struct{}{} })
+		if !stop() {
+			t.Error("stop before cancel returned false")
+		}
+		if stop() {
+			t.Error("second stop returned true")
+		}
+		cancel()
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatal("AfterFunc did not run after cancel")
+		}
+		select {
+		case <-stopped:
+			t.Error("stopped AfterFunc ran")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		//在已结束的上下文上注册，立即运行，stop 返回 false。
+		ran = make(chan struct{})
+		stop = impl.afterFunc(c, func() { close(ran) })
+		<-ran
+		if stop() {
+			t.Error("stop after f started returned true")
+		}
+	})
+}
+
+func TestContextConcurrentCancel(t *testing.T) {
+	forEachImpl(t, func(t *testing.T, impl contextImpl) {
+		root, cancelRoot := impl.withCancel(impl.background())
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c, cancel := impl.withTimeout(root, time.Duration(i)*time.Microsecond)
+				go cancel()
+				go cancelRoot()
+				<-c.Done()
+				c.Err()
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// 下面的用例只针对本包的实现：与标准库的互操作，以及子上下文被取消后从父上下文中摘除。
+
+func TestMyContextInteropWithStd(t *testing.T) {
+	//标准库的父上下文，本包的子上下文。
+	stdParent, cancelStd := context.WithCancelCause(context.WithValue(context.Background(), ctxKey("k"), "v"))
+	myChild, cancelMy := WithCancel(stdParent)
+	defer cancelMy()
+	if myChild.Value(ctxKey("k")) != "v" {
+		t.Error("value of a std parent is not visible")
+	}
+	errBoom := errors.New("boom")
+	cancelStd(errBoom)
+	waitDone(t, myChild)
+	if myChild.Err() != context.Canceled || Cause(myChild) != errBoom {
+		t.Errorf("my child of std parent: err %v, cause %v", myChild.Err(), Cause(myChild))
+	}
+
+	//本包的父上下文，标准库的子上下文，以及接受 context.Context 的标准库函数。
+	myParent, cancelMyParent := WithCancelCause(Background())
+	stdChild, cancelStdChild := context.WithTimeout(myParent, time.Hour)
+	defer cancelStdChild()
+	grandchild, cancelGrandchild := WithCancel(stdChild)
+	defer cancelGrandchild()
+	cancelMyParent(errBoom)
+	waitDone(t, grandchild)
+	if stdChild.Err() != context.Canceled || Cause(stdChild) != errBoom || Cause(grandchild) != errBoom {
+		t.Errorf("std child of my parent: err %v, cause %v, grandchild cause %v", stdChild.Err(), Cause(stdChild), Cause(grandchild))
+	}
+}
+
+// childCount 返回 c 所嵌入的 cancelCtx 中登记的子上下文个数。
+func childCount(c MyContext) int {
+	cc := c.Value(&cancelCtxKey).(*cancelCtx)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return len(cc.children)
+}
+
+func TestMyContextChildrenDetach(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	defer cancel()
+	_, cancelChild := WithCancel(parent)
+	valued := WithValue(parent, ctxKey("k"), 1)
+	timed, cancelTimed := WithTimeout(valued, time.Hour)
+	stop := AfterFunc(parent, func() {})
+	if n := childCount(parent); n != 3 {
+		t.Fatalf("parent has %d children, want 3", n)
+	}
+	cancelChild()
+	cancelTimed()
+	stop()
+	if n := childCount(parent); n != 0 {
+		t.Errorf("parent still has %d children after they were canceled", n)
+	}
+	if timed.(*timerCtx).timer != nil {
+		t.Error("timer of a canceled timerCtx was not stopped")
+	}
+
+	expired, cancelExpired := WithTimeout(parent, time.Millisecond)
+	defer cancelExpired()
+	<-expired.Done()
+	if n := childCount(parent); n != 0 {
+		t.Errorf("expired child still attached: %d children", n)
+	}
+	//父上下文被取消后，子上下文集合被释放。
+	grandchild, _ := WithCancel(expired)
+	if !isDone(grandchild) {
+		t.Error("child of an expired context is not done")
+	}
+}
+
+func TestMyContextString(t *testing.T) {
+	c, cancel := WithCancel(WithValue(Background(), ctxKey("k"), "v"))
+	defer cancel()
+	if got, want := c.(interface{ String() string }).String(), "usecontext.Background.WithValue(k, v).WithCancel"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
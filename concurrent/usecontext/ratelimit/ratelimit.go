@@ -0,0 +1,192 @@
+// Package ratelimit throttles clients with one token bucket per user IP.
+// The IP is the one stored in the request Context by userip.NewContext.
+//
+// ratelimit 包为每个用户 IP 维护一个令牌桶（token bucket）来限制客户端的请求速率。
+// 所用的 IP 是由 userip.NewContext 存入请求 Context 中的 IP。
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/userip"
+)
+
+// ErrTooManyRequests is the error Middleware rejects requests with.
+// ErrTooManyRequests 是 Middleware 拒绝请求时使用的错误。
+var ErrTooManyRequests = errors.New("too many requests")
+
+// A Limiter hands out tokens to clients at Rate per second, letting each
+// client save up at most Burst of them. A Limiter is safe for concurrent use.
+// Limiter 以每秒 Rate 个的速度给客户端发放令牌，每个客户端最多积攒 Burst 个令牌。
+// Limiter 可以被并发使用。
+type Limiter struct {
+	Rate  float64 // tokens added per second 每秒增加的令牌数
+	Burst int     // bucket capacity 令牌桶的容量
+
+	// IdleTTL is how long a bucket may go unused before it is evicted, and
+	// how often the buckets are swept; 0 means one minute. A bucket that has
+	// not refilled yet is kept until it has, so that eviction never lets a
+	// client exceed its limit; it goes at the first sweep after that. If
+	// Rate <= 0, buckets never refill, and an evicted client starts over
+	// with a full bucket.
+	// IdleTTL 是令牌桶未被使用多久之后被清除，也是扫描令牌桶的周期；0 表示一分钟。尚未重新
+	// 装满的桶会一直保留到装满为止，这样清除不会让客户端超出限制；装满之后的第一次扫描就会清除它。
+	// 如果 Rate <= 0，令牌桶永远不会重新装满，被清除的客户端会以一个满的桶重新开始。
+	IdleTTL time.Duration
+
+	// WriteError writes the response of Middleware rejecting req; nil means
+	// http.Error with the text of err. A server sets it to answer in the
+	// same format as its other errors.
+	// WriteError 写出 Middleware 拒绝 req 时的响应，nil 表示以 err 的文本调用 http.Error。
+	// 服务器可以设置它，以便用与其他错误相同的格式来回应。
+	WriteError func(w http.ResponseWriter, req *http.Request, code int, err error)
+
+	// Now returns the current time; nil means time.Now. Tests plug in a fake clock.
+	// Now 返回当前时间，nil 表示 time.Now。测试时可以换成假时钟。
+	Now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was last brought up to date 上次更新 tokens 的时间
+}
+
+// NewLimiter returns a Limiter allowing rate requests per second with bursts of burst.
+// NewLimiter 返回一个每秒允许 rate 个请求、突发量为 burst 的 Limiter。
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst}
+}
+
+// Allow takes one token from key's bucket. If the bucket is empty it returns
+// false and how long the client has to wait for the next token.
+// Allow 从 key 对应的令牌桶中取走一个令牌。如果桶是空的，则返回 false 以及客户端
+// 需要等待多久才能得到下一个令牌。
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(l.Burst), b.tokens+elapsed.Seconds()*l.Rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.Rate <= 0 {
+		return false, l.idleTTL()
+	}
+	return false, seconds((1 - b.tokens) / l.Rate)
+}
+
+// Len reports how many buckets the Limiter currently holds.
+// Len 返回 Limiter 当前持有的令牌桶数量。
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests and a
+// Retry-After header. Requests are keyed by the IP that userip.NewContext
+// stored in their Context, falling back to req.RemoteAddr.
+// Middleware 以 429 Too Many Requests 以及 Retry-After 头部拒绝超出限制的请求。
+// 请求以 userip.NewContext 存入其 Context 中的 IP 为键，如果没有则退而使用 req.RemoteAddr。
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.RemoteAddr
+		if ip, ok := userip.FromContext(req.Context()); ok {
+			key = ip.String()
+		}
+		if ok, retryAfter := l.Allow(key); !ok {
+			secs := int(math.Ceil(retryAfter.Seconds()))
+			if secs < 1 {
+				secs = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			writeError := l.WriteError
+			if writeError == nil {
+				writeError = httpError
+			}
+			writeError(w, req, http.StatusTooManyRequests, ErrTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// sweep evicts the buckets idle for longer than IdleTTL that have refilled.
+// It scans the whole map at most once per IdleTTL, so the cost is amortized
+// over the requests.
+// sweep 清除闲置超过 IdleTTL 并且已经重新装满的令牌桶。它每个 IdleTTL 周期最多扫描一次
+// 整个 map，因此开销被分摊到了各个请求上。
+func (l *Limiter) sweep(now time.Time) {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+		l.lastSweep = now
+		return
+	}
+	ttl := l.idleTTL()
+	if now.Sub(l.lastSweep) < ttl {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if idle := now.Sub(b.last); idle >= ttl && l.refilled(b, idle) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) idleTTL() time.Duration {
+	ttl := time.Minute
+	if l.IdleTTL > 0 {
+		ttl = l.IdleTTL
+	}
+	return ttl
+}
+
+// refilled reports whether b is full again after idling for idle.
+func (l *Limiter) refilled(b *bucket, idle time.Duration) bool {
+	//!!! 在桶装满之前清除它会白白送给客户端一些令牌。用浮点数比较，Rate 很小时也不会溢出。
+	return l.Rate <= 0 || b.tokens+idle.Seconds()*l.Rate >= float64(l.Burst)
+}
+
+// maxWait bounds the Retry-After of a Limiter whose Rate is tiny.
+const maxWait = 24 * time.Hour
+
+// seconds converts secs to a Duration of at most maxWait, which also keeps
+// it from overflowing.
+func seconds(secs float64) time.Duration {
+	if secs >= maxWait.Seconds() {
+		return maxWait
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+func httpError(w http.ResponseWriter, _ *http.Request, code int, err error) {
+	http.Error(w, err.Error(), code)
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
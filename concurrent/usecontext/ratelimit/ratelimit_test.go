@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/userip"
+)
+
+// fakeClock 是一个只有手动拨动才会前进的时钟。
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestLimiterAllow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := NewLimiter(2, 3) //每秒2个令牌，最多积攒3个
+	l.Now = clock.Now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within the burst was rejected", i)
+		}
+	}
+	ok, retryAfter := l.Allow("a")
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("Allow = %v, %v; want false, 500ms", ok, retryAfter)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another client must have its own bucket")
+	}
+	clock.Advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("a token should have been refilled after 500ms")
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := &Limiter{Rate: 1, Burst: 1, IdleTTL: time.Second, Now: clock.Now}
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(key)
+	}
+	if n := l.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+	clock.Advance(2 * time.Second)
+	l.Allow("d")
+	if n := l.Len(); n != 1 {
+		t.Errorf("Len after idle sweep = %d, want 1", n)
+	}
+}
+
+func TestLimiterSlowRefillOutlivesIdleTTL(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	//每 100 秒一个令牌，空桶要 1000 秒才能装满，远长于默认的一分钟 IdleTTL。
+	l := &Limiter{Rate: 0.01, Burst: 10, Now: clock.Now}
+	for range 10 {
+		l.Allow("a")
+	}
+	clock.Advance(2 * time.Minute)
+	l.Allow("b") //触发一次清除
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("the token refilled in 2 minutes was rejected")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("eviction refilled the bucket of a client still over its limit")
+	}
+	clock.Advance(1000 * time.Second)
+	l.Allow("b")
+	if n := l.Len(); n != 1 {
+		t.Errorf("Len = %d after the bucket refilled and idled, want 1", n)
+	}
+}
+
+// TestLimiterTinyRate：Rate 极小时，Burst/Rate 换算成 Duration 会溢出。Retry-After 应该有上限，
+// 扫描仍然每个 IdleTTL 进行一次，而没有装满的桶不能被清除。
+func TestLimiterTinyRate(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := &Limiter{Rate: 1e-12, Burst: 2, IdleTTL: time.Second, Now: clock.Now}
+	l.Allow("a")
+	l.Allow("a")
+	if ok, retryAfter := l.Allow("a"); ok || retryAfter != maxWait {
+		t.Errorf("Allow on an empty bucket = %v, %v; want false, %v", ok, retryAfter, maxWait)
+	}
+	clock.Advance(2 * time.Second)
+	l.Allow("b")
+	if !l.lastSweep.Equal(clock.Now()) {
+		t.Errorf("last sweep at %v, want %v", l.lastSweep, clock.Now())
+	}
+	if n := l.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2: the empty bucket of a must be kept", n)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := &Limiter{Rate: 0.25, Burst: 1, Now: clock.Now}
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	serve := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/search?q=go", nil)
+		req = req.WithContext(userip.NewContext(req.Context(), net.ParseIP(ip)))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := serve("192.0.2.1"); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	rec := serve("192.0.2.1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "4" {
+		t.Errorf("second request: status %d, Retry-After %q; want 429, 4", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("192.0.2.2"); rec.Code != http.StatusOK {
+		t.Errorf("other IP: status %d", rec.Code)
+	}
+}
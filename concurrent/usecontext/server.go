@@ -0,0 +1,235 @@
+package usecontext
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/canceltrace"
+	"com.example/golearn/concurrent/usecontext/google"
+	"com.example/golearn/concurrent/usecontext/metrics"
+	"com.example/golearn/concurrent/usecontext/ratelimit"
+	"com.example/golearn/concurrent/usecontext/userip"
+)
+
+// A Server serves /search with an explicit lifecycle: Start begins listening
+// and Shutdown drains the in-flight searches. Only a Shutdown that runs out
+// of time cancels the searches still running.
+// Server 以明确的生命周期提供 /search 服务：Start 开始监听，Shutdown 让进行中的搜索
+// 排空（drain）。只有超时的 Shutdown 才会取消仍在运行的搜索。
+type Server struct {
+	addr         string
+	handler      http.Handler
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	federation   *google.Federation
+	clientIP     *userip.Extractor
+	limiter      *ratelimit.Limiter
+	heartbeat    time.Duration
+	metrics      *serverMetrics
+
+	srv        *http.Server
+	baseCtx    context.Context
+	cancelBase context.CancelCauseFunc
+	listener   net.Listener
+	serveErr   chan error
+	inflight   sync.WaitGroup //进行中的请求
+}
+
+// An Option configures a Server.
+// Option 用于配置 Server。
+type Option func(*Server)
+
+// WithAddr sets the TCP address to listen on; the default is ":8080".
+// WithAddr 设置监听的 TCP 地址，默认为 ":8080"。
+func WithAddr(addr string) Option { return func(s *Server) { s.addr = addr } }
+
+// WithHandler replaces the /search mux built by the Server, for example to
+// mount it under a larger mux.
+// WithHandler 替换 Server 所构建的 /search 多路复用器，例如把它挂载到更大的多路复用器中。
+func WithHandler(h http.Handler) Option { return func(s *Server) { s.handler = h } }
+
+// WithReadTimeout sets the maximum duration for reading an entire request.
+// WithReadTimeout 设置读取整个请求的最长时间。
+func WithReadTimeout(d time.Duration) Option { return func(s *Server) { s.readTimeout = d } }
+
+// WithWriteTimeout sets the maximum duration before timing out writes of the response.
+// WithWriteTimeout 设置写响应超时之前的最长时间。
+func WithWriteTimeout(d time.Duration) Option { return func(s *Server) { s.writeTimeout = d } }
+
+// WithSources sets the sources every search fans out to; the default is the Google web backend.
+// WithSources 设置每次搜索要分发到的来源，默认为 Google Web 后端。
+func WithSources(sources ...google.Source) Option {
+	return func(s *Server) { s.federation = &google.Federation{Sources: sources} }
+}
+
+// WithClientIP sets the Extractor that finds the user IP of a request. Unless
+// it has a WriteError of its own, the Server sets one answering in the
+// negotiated format.
+// WithClientIP 设置查找请求用户 IP 的 Extractor。除非它已经有自己的 WriteError，
+// Server 会为它设置一个以协商好的格式回应的 WriteError。
+func WithClientIP(e *userip.Extractor) Option { return func(s *Server) { s.clientIP = e } }
+
+// WithLimiter rate-limits /search per user IP; by default there is no limit.
+// Like WithClientIP, the Server sets its WriteError unless it has one.
+// WithLimiter 按用户 IP 对 /search 限流，默认不限流。与 WithClientIP 一样，
+// 除非 Limiter 已经有 WriteError，Server 会为它设置一个。
+func WithLimiter(l *ratelimit.Limiter) Option { return func(s *Server) { s.limiter = l } }
+
+// WithHeartbeat sets how often /search/stream sends a heartbeat comment while
+// waiting for results; the default is 15s, and d <= 0 disables heartbeats.
+// WithHeartbeat 设置 /search/stream 在等待结果时多久发送一次心跳注释，默认为 15 秒；
+// d <= 0 表示不发送心跳。
+func WithHeartbeat(d time.Duration) Option { return func(s *Server) { s.heartbeat = d } }
+
+// NewServer returns a Server configured by opts. It does not listen until Start.
+// NewServer 返回一个由 opts 配置的 Server，直到调用 Start 才开始监听。
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		addr:       ":8080",
+		heartbeat:  15 * time.Second,
+		federation: &google.Federation{Sources: []google.Source{{Name: "google", Backend: google.BackendFunc(google.Search)}}},
+		clientIP:   &userip.Extractor{},
+		metrics:    newServerMetrics(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	//中间件拒绝请求时，与处理器一样按照协商好的格式（例如 JSON）回应。
+	if s.clientIP.WriteError == nil {
+		s.clientIP.WriteError = writeRequestError
+	}
+	if s.limiter != nil && s.limiter.WriteError == nil {
+		s.limiter.WriteError = writeRequestError
+	}
+	s.metrics.exportCaches(s.federation.Sources)
+	if s.handler == nil {
+		s.handler = s.searchMux()
+	}
+	s.baseCtx, s.cancelBase = context.WithCancelCause(context.Background())
+	return s
+}
+
+// NewTestServer starts a Server on an httptest loopback listener and returns
+// both; the httptest.Server's URL is where to send requests. Stop it with
+// Shutdown or with the httptest.Server's Close.
+// NewTestServer 在 httptest 的回环监听器上启动一个 Server，并把两者一起返回；
+// 请求应发送到 httptest.Server 的 URL。可以用 Shutdown 或者 httptest.Server 的 Close 停止它。
+func NewTestServer(opts ...Option) (*Server, *httptest.Server) {
+	s := NewServer(opts...)
+	ts := httptest.NewUnstartedServer(s.Handler())
+	s.configure(ts.Config)
+	s.listener = ts.Listener
+	ts.Start()
+	return s, ts
+}
+
+// Handler returns the http.Handler of the Server, ready for httptest.NewServer.
+// Handler 返回 Server 的 http.Handler，可以直接交给 httptest.NewServer 使用。
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.inflight.Add(1)
+		defer s.inflight.Done()
+		s.handler.ServeHTTP(w, req)
+	})
+}
+
+// Metrics returns the registry served on /metrics, for mounting it elsewhere
+// when WithHandler replaces the Server's mux.
+// Metrics 返回在 /metrics 上提供的指标注册表，以便在 WithHandler 替换了 Server 的
+// 多路复用器时把它挂载到别处。
+func (s *Server) Metrics() *metrics.Registry { return s.metrics.registry }
+
+// Start listens on the configured address and serves in a new goroutine. It
+// returns once the listener is bound, so Addr is valid afterwards. Request
+// contexts carry the values of ctx but are not canceled with it: a signal
+// context passed here must only trigger Shutdown, which lets the in-flight
+// searches finish.
+// Start 在配置的地址上监听，并在新的 goroutine 中提供服务。监听器绑定后它就返回，
+// 因此之后 Addr 是有效的。请求的 context 带有 ctx 中的值，但不会随 ctx 一起被取消：
+// 传入的信号 context 只应该用来触发 Shutdown，由它让进行中的搜索完成。
+func (s *Server) Start(ctx context.Context) error {
+	if s.srv != nil {
+		return errors.New("usecontext: server already started")
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	//!!! 与 ctx 的取消脱钩：否则 Ctrl-C 会立即取消所有进行中的搜索，Shutdown 的宽限期就形同虚设。
+	s.baseCtx, s.cancelBase = context.WithCancelCause(context.WithoutCancel(ctx))
+	s.listener = ln
+	s.configure(&http.Server{Handler: s.Handler()})
+	s.serveErr = make(chan error, 1)
+	go func() {
+		s.serveErr <- s.srv.Serve(ln)
+	}()
+	return nil
+}
+
+// Addr returns the address the Server listens on, or "" before Start.
+// Addr 返回 Server 所监听的地址，Start 之前返回 ""。
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops accepting connections and waits for in-flight searches to
+// finish. If ctx is done first, it cancels the contexts of the searches still
+// running, closes the connections so that handlers blocked writing to a
+// stalled client fail, waits for the handlers to return and returns ctx.Err().
+// Shutdown 停止接受连接，并等待进行中的搜索完成。如果 ctx 先结束，它就取消仍在运行的
+// 搜索的 context，关闭连接，使阻塞在向停滞的客户端写入的处理器失败，等待处理器返回，
+// 并返回 ctx.Err()。
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.srv == nil {
+		return errors.New("usecontext: server not started")
+	}
+	err := s.srv.Shutdown(ctx)
+	s.cancelBase(canceltrace.ErrServerShutdown)
+	if err != nil {
+		//!!! 宽限期已过：先关闭连接再等待，否则阻塞在写入上的处理器（例如没有 WriteTimeout 的 SSE 流）永远不会返回。
+		s.srv.Close()
+		s.inflight.Wait()
+	}
+	if s.serveErr != nil {
+		if serr := <-s.serveErr; !errors.Is(serr, http.ErrServerClosed) && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// configure applies the options of s to srv and remembers it.
+func (s *Server) configure(srv *http.Server) {
+	srv.ReadTimeout = s.readTimeout
+	srv.WriteTimeout = s.writeTimeout
+	srv.BaseContext = func(net.Listener) context.Context { return s.baseCtx }
+	s.srv = srv
+}
+
+// searchMux routes /search and /search/stream through the user IP and rate
+// limiting middlewares, counts /search in the metrics, and serves the
+// metrics on /metrics.
+// searchMux 让 /search 与 /search/stream 依次经过用户 IP 与限流中间件，在指标中统计
+// /search，并在 /metrics 上提供指标。
+func (s *Server) searchMux() http.Handler {
+	limited := func(h http.HandlerFunc) http.Handler {
+		if s.limiter == nil {
+			return h
+		}
+		return s.limiter.Middleware(h)
+	}
+	//先把用户 IP 存入请求的 Context，限流器才能按 IP 计数。
+	mux := http.NewServeMux()
+	mux.Handle("/search", s.metrics.instrument(s.clientIP.Middleware(limited(s.handleSearch))))
+	mux.Handle("/search/stream", s.clientIP.Middleware(limited(s.handleSearchStream)))
+	mux.Handle("/metrics", s.metrics.registry)
+	return mux
+}
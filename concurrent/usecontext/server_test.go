@@ -0,0 +1,240 @@
+package usecontext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/google"
+	"com.example/golearn/concurrent/usecontext/ratelimit"
+)
+
+// blockingBackend 在 release 关闭或者 ctx 结束之前一直阻塞，并通过 started 报告搜索已经开始。
+func blockingBackend(started chan<- struct{}, release <-chan struct{}) google.Backend {
+	return google.BackendFunc(func(ctx context.Context, query string) (google.Results, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return google.Results{{Title: "done", URL: "https://done.example/"}}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+func TestServerStartAndShutdown(t *testing.T) {
+	s := newTestIndexServer(t, WithAddr("127.0.0.1:0"))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + s.Addr() + "/search?q=context&format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "pkg.go.dev/context") {
+		t.Errorf("status %d, body %s", resp.StatusCode, body)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if _, err := http.Get("http://" + s.Addr() + "/search?q=go"); err == nil {
+		t.Error("server still answers after Shutdown")
+	}
+}
+
+func TestShutdownDrainsInFlightSearches(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	s, ts := NewTestServer(WithSources(google.Source{Name: "slow", Backend: blockingBackend(started, release)}))
+	defer ts.Close()
+
+	chStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(ts.URL + "/search?q=go")
+		if err != nil {
+			chStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		chStatus <- resp.StatusCode
+	}()
+	<-started
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release) //在宽限期内让搜索完成
+	}()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if code := <-chStatus; code != http.StatusOK {
+		t.Errorf("drained search status = %d, want 200", code)
+	}
+}
+
+func TestShutdownCancelsSearchesAfterGracePeriod(t *testing.T) {
+	started := make(chan struct{}, 1)
+	s, ts := NewTestServer(WithSources(google.Source{Name: "stuck", Backend: blockingBackend(started, nil)}))
+	defer ts.Close()
+
+	chStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(ts.URL + "/search?q=go")
+		if err != nil {
+			chStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		chStatus <- resp.StatusCode
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want deadline exceeded", err)
+	}
+	//搜索的 context 被取消后，处理器返回 500，或者连接已被关闭。
+	if code := <-chStatus; code != http.StatusInternalServerError && code != 0 {
+		t.Errorf("canceled search status = %d", code)
+	}
+}
+
+func TestHandleSearchFailsFastWhenBreakerOpen(t *testing.T) {
+	breaker := &google.Breaker{
+		Name: "down", FailureThreshold: 1, CoolDown: time.Minute,
+		Backend: google.BackendFunc(func(context.Context, string) (google.Results, error) {
+			return nil, errors.New("upstream down")
+		}),
+	}
+	s := NewServer(WithSources(google.Source{Name: "down", Backend: breaker}))
+	if rec := s.search("/search?q=go"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first failure: status %d, want 500", rec.Code)
+	}
+	start := time.Now()
+	rec := s.search("/search?q=go&timeout=10s&format=json")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("open breaker: status %d, Retry-After %q; want 503, 60", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("open breaker took %v instead of failing fast", elapsed)
+	}
+}
+
+func TestMiddlewareErrorsAreNegotiated(t *testing.T) {
+	s := newTestIndexServer(t, WithLimiter(ratelimit.NewLimiter(0.001, 1)))
+	decode := func(rec *httptest.ResponseRecorder) errorBody {
+		t.Helper()
+		var body errorBody
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Content-Type = %q, body %q", ct, rec.Body)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("error body %q: %v", rec.Body, err)
+		}
+		return body
+	}
+
+	if rec := s.search("/search?q=go", "Accept", "application/json"); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	//限流器拒绝的请求同样按照 Accept 头部回应 JSON。
+	rec := s.search("/search?q=go", "Accept", "application/json")
+	if body := decode(rec); rec.Code != http.StatusTooManyRequests || body.Error.Status != http.StatusTooManyRequests ||
+		body.Error.Message != "too many requests" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("limited: status %d, Retry-After %q, body %+v", rec.Code, rec.Header().Get("Retry-After"), body)
+	}
+	if rec := s.search("/search?q=go"); rec.Code != http.StatusTooManyRequests || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("limited without Accept: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	//无法解析的客户端地址由用户 IP 中间件以 400 拒绝。
+	req := httptest.NewRequest("GET", "/search?q=go&format=json", nil)
+	req.RemoteAddr = "not an address"
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if body := decode(rec); rec.Code != http.StatusBadRequest || body.Error.Status != http.StatusBadRequest ||
+		!strings.Contains(body.Error.Message, "not IP:port") {
+		t.Errorf("bad client IP: status %d, body %+v", rec.Code, body)
+	}
+}
+
+func TestInterruptLetsSearchesFinish(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	s := NewServer(WithAddr("127.0.0.1:0"), WithSources(google.Source{Name: "slow", Backend: blockingBackend(started, release)}))
+	ctx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- shutdownWhenDone(ctx, s, 5*time.Second) }()
+
+	chStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.Addr() + "/search?q=go")
+		if err != nil {
+			chStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		chStatus <- resp.StatusCode
+	}()
+	<-started
+	interrupt() //相当于 Run 中的 Ctrl-C：只触发 Shutdown，不取消进行中的搜索。
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if code := <-chStatus; code != http.StatusOK {
+		t.Errorf("search interrupted mid-request: status %d, want 200", code)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("shutdownWhenDone = %v", err)
+	}
+}
+
+// TestShutdownUnblocksStalledWrites：客户端不再读取时，处理器会阻塞在写入上；
+// 宽限期过后 Shutdown 必须关闭连接让它返回，而不是永远等待。
+func TestShutdownUnblocksStalledWrites(t *testing.T) {
+	writing := make(chan struct{})
+	stalled := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		chunk := make([]byte, 64<<10)
+		for i := 0; ; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			if i == 0 {
+				close(writing)
+			}
+		}
+	})
+	s := NewServer(WithAddr("127.0.0.1:0"), WithHandler(stalled))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n") //之后不再读取
+	<-writing
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	chErr := make(chan error, 1)
+	go func() { chErr <- s.Shutdown(ctx) }()
+	select {
+	case err := <-chErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown hangs on a handler stuck in a write")
+	}
+}
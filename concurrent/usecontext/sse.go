@@ -0,0 +1,265 @@
+package usecontext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/canceltrace"
+	"com.example/golearn/concurrent/usecontext/google"
+	"com.example/golearn/concurrent/usecontext/userip"
+)
+
+// handleSearchStream handles URLs like /search/stream?q=golang&timeout=1m by
+// pushing every result over Server-Sent Events as soon as a source finds it.
+// Each result is a "result" event whose id is the resume cursor; a reconnect
+// with that id in the Last-Event-ID header (or the lastEventId query param)
+// skips what was already delivered. While waiting it sends heartbeat
+// comments, and the stream ends with a "summary" or an "error" event. The
+// sources are canceled the moment the client goes away. A resumed stream
+// holds new results back until the sources in the cursor have replayed the
+// results it covers, so that a duplicate of a delivered URL is never sent.
+// handleSearchStream 处理诸如 /search/stream?q=golang&timeout=1m 这样的请求，在某个来源
+// 找到结果时立即通过 Server-Sent Events 推送出去。每个结果都是一个 "result" 事件，其 id
+// 就是恢复游标；带着该 id（放在 Last-Event-ID 头部或 lastEventId 查询参数中）重新连接，
+// 就会跳过已经交付的内容。等待期间它发送心跳注释，流以一个 "summary" 或 "error" 事件结束。
+// 客户端一离开，各个来源就被取消。恢复的流会先扣留新的结果，直到游标中的来源重放完游标
+// 所涵盖的结果，这样已经交付过的 URL 的重复项永远不会被发送。
+func (s *Server) handleSearchStream(w http.ResponseWriter, req *http.Request) {
+	query := req.FormValue("q")
+	if query == "" {
+		writeError(w, formatJSON, http.StatusBadRequest, errors.New("no query"))
+		return
+	}
+	lastID := req.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = req.FormValue("lastEventId")
+	}
+	cursor, err := parseStreamCursor(lastID)
+	if err != nil {
+		writeError(w, formatJSON, http.StatusBadRequest, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, formatJSON, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+	userIP, ok := userip.FromContext(req.Context())
+	if !ok {
+		if userIP, err = s.clientIP.FromRequest(req); err != nil {
+			writeError(w, formatJSON, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// The stream lives as long as the client stays, unless it asked for a timeout.
+	//只要客户端还在，流就一直存在，除非客户端要求了超时。
+	reqCtx, cancelRequest := s.requestScope(req)
+	defer cancelRequest(canceltrace.ErrReturned)
+	var (
+		ctx    context.Context
+		cancel context.CancelCauseFunc
+	)
+	timeout, err := time.ParseDuration(req.FormValue("timeout"))
+	if err == nil {
+		ctx, cancel = canceltrace.WithTimeout(reqCtx, "stream", timeout)
+	} else {
+		ctx, cancel = canceltrace.WithCancel(reqCtx, "stream")
+	}
+	defer cancel(canceltrace.ErrReturned)
+	ctx = userip.NewContext(ctx, userIP)
+	ctx = google.WithCacheMode(ctx, cacheModeFromRequest(req))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") //让反向代理不要缓冲事件
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	sw := &sseWriter{w: w, flusher: flusher}
+
+	// The federation runs in its own goroutine so that this one can send
+	// heartbeats; emit blocks until the loop below takes the result or ctx is done.
+	//联合搜索在自己的 goroutine 中运行，这样当前 goroutine 才能发送心跳；
+	//emit 会一直阻塞，直到下面的循环取走结果或者 ctx 结束。
+	type found struct {
+		source string
+		rank   int
+		result google.Result
+	}
+	type outcome struct {
+		sources []google.SourceReport
+		err     error
+	}
+	chFound := make(chan found)
+	chOutcome := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		sources, err := s.federation.StreamSources(ctx, query, func(source string, rank int, r google.Result) {
+			select {
+			case chFound <- found{source, rank, r}:
+			case <-ctx.Done():
+			}
+		})
+		chOutcome <- outcome{sources, err}
+	}()
+
+	var chHeartbeat <-chan time.Time //WithHeartbeat(d <= 0) 关闭心跳：nil 信道永远不会就绪
+	if s.heartbeat > 0 {
+		heartbeat := time.NewTicker(s.heartbeat)
+		defer heartbeat.Stop()
+		chHeartbeat = heartbeat.C
+	}
+	// On a resume the URLs consumed before are those in the first cursor[s]
+	// results of every source s. Until each such source has replayed them,
+	// a new result might duplicate one of them, so new results are held.
+	//恢复时，之前处理过的 URL 就是每个来源 s 的前 cursor[s] 个结果。在这些来源都重放完它们
+	//之前，新的结果可能与其中某个重复，因此先把新的结果扣留下来。
+	resumed := maps.Clone(cursor)
+	replaying := 0
+	for _, n := range resumed {
+		if n > 0 {
+			replaying++
+		}
+	}
+	var held []found
+	seen := make(map[string]bool)
+	deliver := func(f found) {
+		cursor.advance(f.source, f.rank)
+		if seen[f.result.URL] {
+			return
+		}
+		seen[f.result.URL] = true
+		if err := sw.event(cursor.String(), "result", f.result); err != nil {
+			cancel(canceltrace.ErrClientDisconnected)
+		}
+	}
+	release := func() {
+		for _, f := range held {
+			deliver(f)
+		}
+		held = nil
+	}
+	for {
+		select {
+		case f := <-chFound:
+			switch n := resumed[f.source]; {
+			case f.rank < n:
+				seen[f.result.URL] = true //已经交付过，或者作为重复项跳过了
+				if f.rank == n-1 {
+					if replaying--; replaying == 0 {
+						release()
+					}
+				}
+			case replaying > 0:
+				held = append(held, f)
+			default:
+				deliver(f)
+			}
+		case <-chHeartbeat:
+			if err := sw.comment("heartbeat"); err != nil {
+				cancel(canceltrace.ErrClientDisconnected)
+			}
+		case o := <-chOutcome:
+			release() //某些来源这次返回的结果少于游标中的数目，或者失败了
+			elapsed := time.Since(start)
+			s.metrics.observeSearch(ctx, elapsed, timeout)
+			if o.err != nil {
+				err := searchFailed(ctx, cancel, query, o.err)
+				sw.event("", "error", newErrorBody(searchErrorStatus(w, err), err))
+				return
+			}
+			sw.event(cursor.String(), "summary", newSearchSummary(o.sources, elapsed, timeout))
+			return
+		}
+	}
+}
+
+// streamCursor maps a source name to the number of its results a stream has
+// consumed, delivered or skipped as duplicates. It is encoded like a query
+// string, as in "docs=3&google=5", so the order sources answer in does not matter.
+// streamCursor 把来源名称映射为流已经处理过（交付或者作为重复项跳过）的该来源结果数。
+// 它像查询字符串那样编码，例如 "docs=3&google=5"，因此与来源回答的顺序无关。
+type streamCursor map[string]int
+
+func parseStreamCursor(id string) (streamCursor, error) {
+	values, err := url.ParseQuery(id)
+	if err != nil {
+		return nil, fmt.Errorf("bad Last-Event-ID %q: %w", id, err)
+	}
+	c := make(streamCursor, len(values))
+	for source, v := range values {
+		n, err := strconv.Atoi(v[len(v)-1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad Last-Event-ID %q: count of %s is not a natural number", id, source)
+		}
+		c[source] = n
+	}
+	return c, nil
+}
+
+// advance records that the result of source at rank has been consumed.
+func (c streamCursor) advance(source string, rank int) {
+	c[source] = max(c[source], rank+1)
+}
+
+func (c streamCursor) String() string {
+	values := make(url.Values, len(c))
+	for source, n := range c {
+		values.Set(source, strconv.Itoa(n))
+	}
+	return values.Encode()
+}
+
+// sseWriter writes Server-Sent Events and flushes each one to the client.
+// After the first failed write it writes nothing more.
+// sseWriter 写出 Server-Sent Events，并把每个事件立即刷新到客户端。第一次写失败之后，
+// 它就不再写任何内容。
+type sseWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	err     error
+}
+
+// event writes an event named name with v as its JSON data and, unless id
+// is "", id as its id.
+// event 写出一个名为 name 的事件，以 v 的 JSON 作为数据；id 不为 "" 时以 id 作为事件 id。
+func (sw *sseWriter) event(id, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		sw.printf("id: %s\n", id)
+	}
+	sw.printf("event: %s\ndata: %s\n\n", name, data)
+	return sw.flush()
+}
+
+// comment writes a comment line, which clients ignore; it keeps idle
+// connections and proxies from timing out.
+// comment 写出一行注释，客户端会忽略它；它使空闲的连接与代理不会超时。
+func (sw *sseWriter) comment(text string) error {
+	sw.printf(": %s\n\n", text)
+	return sw.flush()
+}
+
+func (sw *sseWriter) printf(format string, args ...any) {
+	if sw.err == nil {
+		_, sw.err = fmt.Fprintf(sw.w, format, args...)
+	}
+}
+
+func (sw *sseWriter) flush() error {
+	if sw.err == nil {
+		sw.flusher.Flush()
+	}
+	return sw.err
+}
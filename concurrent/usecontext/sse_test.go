@@ -0,0 +1,219 @@
+package usecontext
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"com.example/golearn/concurrent/usecontext/google"
+)
+
+// sseEvent 是从流中解析出的一个事件；注释（心跳）的 name 为 ":"。
+type sseEvent struct {
+	id, name, data string
+}
+
+// readEvents 读取 SSE 流中的事件，直到流结束。
+func readEvents(t *testing.T, body io.Reader) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var ev sseEvent
+	sc := bufio.NewScanner(body)
+	for sc.Scan() {
+		line := sc.Text()
+		field, value, _ := strings.Cut(line, ": ")
+		switch {
+		case line == "":
+			events = append(events, ev)
+			ev = sseEvent{}
+		case field == "":
+			ev.name = ":"
+		case field == "id":
+			ev.id = value
+		case field == "event":
+			ev.name = value
+		case field == "data":
+			ev.data = value
+		}
+	}
+	return events
+}
+
+// fixedBackend 在 delay 之后返回给定的结果。
+func fixedBackend(delay time.Duration, results ...google.Result) google.Backend {
+	return google.BackendFunc(func(ctx context.Context, query string) (google.Results, error) {
+		select {
+		case <-time.After(delay):
+			return results, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+func streamFrom(t *testing.T, url, lastEventID string) []sseEvent {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, ct)
+	}
+	return readEvents(t, resp.Body)
+}
+
+func TestSearchStreamAndResume(t *testing.T) {
+	a1 := google.Result{Title: "a1", URL: "https://a.example/1"}
+	a2 := google.Result{Title: "a2", URL: "https://a.example/2"}
+	b1 := google.Result{Title: "b1", URL: "https://b.example/1"}
+	_, ts := NewTestServer(
+		WithSources(
+			google.Source{Name: "fast", Backend: fixedBackend(0, a1, a2)},
+			google.Source{Name: "slow", Backend: fixedBackend(50*time.Millisecond, a2, b1)},
+		),
+		WithHeartbeat(10*time.Millisecond),
+	)
+	defer ts.Close()
+
+	events := streamFrom(t, ts.URL+"/search/stream?q=go", "")
+	var results []sseEvent
+	heartbeats := 0
+	for _, ev := range events {
+		switch ev.name {
+		case "result":
+			results = append(results, ev)
+		case ":":
+			heartbeats++
+		}
+	}
+	if heartbeats == 0 {
+		t.Error("no heartbeat while waiting for the slow source")
+	}
+	//a2 在两个来源中都出现，只交付一次。
+	if len(results) != 3 {
+		t.Fatalf("result events = %v", results)
+	}
+	var r google.Result
+	if err := json.Unmarshal([]byte(results[2].data), &r); err != nil || r != b1 {
+		t.Errorf("last result = %v, %v", r, err)
+	}
+	if last := events[len(events)-1]; last.name != "summary" || !strings.Contains(last.data, `"status":"answered"`) {
+		t.Errorf("last event = %+v", last)
+	}
+
+	//在第一个结果之后断开，再带着它的 id 重新连接：只交付剩下的结果。
+	resumed := streamFrom(t, ts.URL+"/search/stream?q=go", results[0].id)
+	var urls []string
+	for _, ev := range resumed {
+		if ev.name == "result" {
+			json.Unmarshal([]byte(ev.data), &r)
+			urls = append(urls, r.URL)
+		}
+	}
+	if strings.Join(urls, " ") != a2.URL+" "+b1.URL {
+		t.Errorf("resumed from %q got %v", results[0].id, urls)
+	}
+
+	//从最后的游标恢复，什么结果也不会重复交付。
+	for _, ev := range streamFrom(t, ts.URL+"/search/stream?q=go", events[len(events)-1].id) {
+		if ev.name == "result" {
+			t.Errorf("resumed after the summary got %v", ev)
+		}
+	}
+}
+
+// TestSearchStreamResumeReversedOrder：第一次连接交付了 a 中的 x，在 b 回答之前断开；
+// 重新连接时 b 先回答，它的 x 副本也不能再次交付。
+func TestSearchStreamResumeReversedOrder(t *testing.T) {
+	x := google.Result{Title: "x", URL: "https://x.example/"}
+	a2 := google.Result{Title: "a2", URL: "https://a.example/2"}
+	b2 := google.Result{Title: "b2", URL: "https://b.example/2"}
+	_, ts := NewTestServer(WithSources(
+		google.Source{Name: "a", Backend: fixedBackend(50*time.Millisecond, x, a2)},
+		google.Source{Name: "b", Backend: fixedBackend(0, x, b2)},
+	))
+	defer ts.Close()
+
+	var urls []string
+	for _, ev := range streamFrom(t, ts.URL+"/search/stream?q=go", "a=1") {
+		if ev.name == "result" {
+			var r google.Result
+			json.Unmarshal([]byte(ev.data), &r)
+			urls = append(urls, r.URL)
+		}
+	}
+	if strings.Join(urls, " ") != b2.URL+" "+a2.URL {
+		t.Errorf("resumed from a=1 got %v, want [%s %s]", urls, b2.URL, a2.URL)
+	}
+}
+
+func TestSearchStreamStopsUpstreamOnDisconnect(t *testing.T) {
+	started := make(chan struct{}, 1)
+	chCause := make(chan error, 1)
+	backend := google.BackendFunc(func(ctx context.Context, query string) (google.Results, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		chCause <- context.Cause(ctx)
+		return nil, ctx.Err()
+	})
+	_, ts := NewTestServer(WithSources(google.Source{Name: "forever", Backend: backend}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/search/stream?q=go", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	<-started
+	cancel()
+	select {
+	case cause := <-chCause:
+		if !strings.Contains(cause.Error(), "client disconnected") {
+			t.Errorf("upstream canceled with cause %v", cause)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("upstream still running after the client went away")
+	}
+}
+
+func TestSearchStreamBadRequests(t *testing.T) {
+	_, ts := NewTestServer(WithSources(google.Source{Name: "fast", Backend: fixedBackend(0)}))
+	defer ts.Close()
+	for _, target := range []string{"/search/stream", "/search/stream?q=go&lastEventId=fast%3Dx"} {
+		resp, err := http.Get(ts.URL + target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, resp.StatusCode)
+		}
+	}
+}
+
+func TestSearchStreamWithoutHeartbeat(t *testing.T) {
+	r := google.Result{Title: "r", URL: "https://r.example/"}
+	_, ts := NewTestServer(WithHeartbeat(0), WithSources(google.Source{Name: "a", Backend: fixedBackend(20*time.Millisecond, r)}))
+	defer ts.Close()
+	events := streamFrom(t, ts.URL+"/search/stream?q=go", "")
+	var names []string
+	for _, ev := range events {
+		names = append(names, ev.name)
+	}
+	if len(names) != 2 || names[0] != "result" || names[1] != "summary" {
+		t.Errorf("events %v, want a result and the summary without heartbeats", names)
+	}
+}
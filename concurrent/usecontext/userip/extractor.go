@@ -0,0 +1,186 @@
+package userip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// An Extractor finds the user IP address of a request that may have passed
+// through reverse proxies. Forwarding headers are only believed when they were
+// added by a proxy inside TrustedProxies; anybody else could forge them.
+// Extractor 找出可能经过了反向代理的请求的用户 IP 地址。只有当转发头部是由
+// TrustedProxies 中的代理添加时才可信，因为其他任何人都可以伪造这些头部。
+//
+// The headers are consulted in this order, the first one present wins:
+// RFC 7239 Forwarded, X-Forwarded-For, X-Real-IP.
+// 头部按以下顺序查看，第一个出现的头部生效：RFC 7239 Forwarded、X-Forwarded-For、X-Real-IP。
+type Extractor struct {
+	// TrustedProxies lists the networks of the proxies in front of the server.
+	// TrustedProxies 列出了位于服务器之前的代理所在的网络。
+	TrustedProxies []*net.IPNet
+
+	// WriteError writes the response of Middleware rejecting req; nil means
+	// http.Error with the text of err. A server sets it to answer in the
+	// same format as its other errors.
+	// WriteError 写出 Middleware 拒绝 req 时的响应，nil 表示以 err 的文本调用 http.Error。
+	// 服务器可以设置它，以便用与其他错误相同的格式来回应。
+	WriteError func(w http.ResponseWriter, req *http.Request, code int, err error)
+}
+
+// NewExtractor returns an Extractor trusting the given CIDRs. A plain IP
+// address is taken as a single-host network.
+// NewExtractor 返回一个信任给定 CIDR 的 Extractor。单独的 IP 地址被当作只有一台主机的网络。
+func NewExtractor(cidrs ...string) (*Extractor, error) {
+	e := &Extractor{}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("userip: %q is not an IP or CIDR", c)
+			}
+			ip = Normalize(ip)
+			c = fmt.Sprintf("%s/%d", ip, len(ip)*8)
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("userip: %q is not an IP or CIDR", c)
+		}
+		e.TrustedProxies = append(e.TrustedProxies, n)
+	}
+	return e, nil
+}
+
+// FromRequest extracts the user IP address from req. Starting at the peer
+// that opened the connection, it walks the forwarding chain from right to
+// left for as long as the hops are trusted proxies, and returns the first
+// address that is not.
+// FromRequest 从 req 中提取用户 IP 地址。它从建立连接的对端开始，只要途经的节点（hop）
+// 是可信代理，就沿着转发链从右向左回溯，并返回第一个不可信的地址。
+func (e *Extractor) FromRequest(req *http.Request) (net.IP, error) {
+	peer, err := remoteIP(req)
+	if err != nil {
+		return nil, err
+	}
+	if !e.trusted(peer) {
+		return peer, nil
+	}
+	hops := forwardedHops(req.Header)
+	ip := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHop(hops[i])
+		if hop == nil {
+			//无法解析的节点（例如 "unknown" 或被混淆的标识）之后的信息都不可信，
+			//只能停在最后一个可信代理所看到的地址上。
+			break
+		}
+		ip = hop
+		if !e.trusted(hop) {
+			break
+		}
+	}
+	return ip, nil
+}
+
+func (e *Extractor) trusted(ip net.IP) bool {
+	for _, n := range e.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns the 4-byte form of IPv4 and IPv4-mapped IPv6 addresses
+// and ip itself otherwise, so that ::ffff:192.0.2.1 and 192.0.2.1 compare equal.
+// Normalize 对 IPv4 以及映射到 IPv6 的 IPv4 地址返回其 4 字节形式，其他地址原样返回，
+// 这样 ::ffff:192.0.2.1 与 192.0.2.1 就相等了。
+func Normalize(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func remoteIP(req *http.Request) (net.IP, error) {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("userip: %q is not IP:port", req.RemoteAddr)
+	}
+	userIP := net.ParseIP(ip)
+	if userIP == nil {
+		return nil, fmt.Errorf("userip: %q is not IP:port", req.RemoteAddr)
+	}
+	return Normalize(userIP), nil
+}
+
+// forwardedHops returns the client addresses recorded by the proxies,
+// leftmost (closest to the user) first.
+func forwardedHops(h http.Header) []string {
+	if vs := h.Values("Forwarded"); len(vs) > 0 {
+		var hops []string
+		for _, v := range vs {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(k, "for") {
+						hops = append(hops, strings.Trim(val, `"`))
+					}
+				}
+			}
+		}
+		return hops
+	}
+	if vs := h.Values("X-Forwarded-For"); len(vs) > 0 {
+		var hops []string
+		for _, v := range vs {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+		return hops
+	}
+	if v := h.Get("X-Real-IP"); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+// parseHop parses one node of a forwarding header: a bare IP, an IP with a
+// port, or a bracketed IPv6 address with an optional port. It returns nil for
+// anything else.
+func parseHop(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	return Normalize(ip)
+}
+
+// Middleware stores the user IP of every request in the request's Context, so
+// that later handlers can read it with FromContext. Requests whose address
+// cannot be parsed are rejected with 400 Bad Request.
+// Middleware 把每个请求的用户 IP 存入请求的 Context，后续处理器可以用 FromContext 读取。
+// 地址无法解析的请求会以 400 Bad Request 拒绝。
+func (e *Extractor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip, err := e.FromRequest(req)
+		if err != nil {
+			if e.WriteError != nil {
+				e.WriteError(w, req, http.StatusBadRequest, err)
+			} else {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(NewContext(req.Context(), ip)))
+	})
+}
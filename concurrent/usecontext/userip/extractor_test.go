@@ -0,0 +1,66 @@
+package userip
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractorFromRequest(t *testing.T) {
+	e, err := NewExtractor("10.0.0.0/8", "192.0.2.1", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"untrusted peer forging XFF", "203.0.113.7:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy XFF", "10.1.1.1:80", map[string]string{"X-Forwarded-For": "198.51.100.9, 10.2.2.2"}, "198.51.100.9"},
+		{"spoofed leftmost XFF", "10.1.1.1:80", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.9"}, "198.51.100.9"},
+		{"X-Real-IP", "192.0.2.1:80", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		{"Forwarded wins over XFF", "10.1.1.1:80", map[string]string{
+			"Forwarded":       `for="[2001:db8:cafe::17]:4711";proto=https, for=198.51.100.9;by=10.1.1.1`,
+			"X-Forwarded-For": "1.2.3.4",
+		}, "198.51.100.9"},
+		{"Forwarded through trusted IPv6", "10.1.1.1:80", map[string]string{
+			"Forwarded": `for=198.51.100.9, for="[2001:db8:cafe::17]:4711"`,
+		}, "198.51.100.9"},
+		{"unknown hop stops the walk", "10.1.1.1:80", map[string]string{"Forwarded": "for=198.51.100.9, for=unknown"}, "10.1.1.1"},
+		{"IPv4-mapped peer", "[::ffff:10.1.1.1]:80", map[string]string{"X-Forwarded-For": "::ffff:198.51.100.9"}, "198.51.100.9"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		ip, err := e.FromRequest(req)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		//IPv4 地址必须已被规范化为 4 字节形式。
+		if ip.String() != tt.want || ip.To4() != nil && len(ip) != net.IPv4len {
+			t.Errorf("%s: got %s (len %d), want %s", tt.name, ip, len(ip), tt.want)
+		}
+	}
+}
+
+func TestNewExtractorRejectsGarbage(t *testing.T) {
+	if _, err := NewExtractor("not-an-ip"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestNewContextNormalizes(t *testing.T) {
+	ctx := NewContext(context.Background(), net.ParseIP("::ffff:192.0.2.1"))
+	ip, ok := FromContext(ctx)
+	if !ok || len(ip) != net.IPv4len || ip.String() != "192.0.2.1" {
+		t.Errorf("FromContext = %v (len %d), want 4-byte 192.0.2.1", ip, len(ip))
+	}
+}
@@ -9,23 +9,15 @@ package userip
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"net/http"
 )
 
 // FromRequest extracts the user IP address from req, if present.
+// It only looks at req.RemoteAddr; use an Extractor behind reverse proxies.
+// FromRequest 只查看 req.RemoteAddr；位于反向代理之后时应使用 Extractor。
 func FromRequest(req *http.Request) (net.IP, error) {
-	ip, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		return nil, fmt.Errorf("userip: %q is not IP:port", req.RemoteAddr)
-	}
-
-	userIP := net.ParseIP(ip)
-	if userIP == nil {
-		return nil, fmt.Errorf("userip: %q is not IP:port", req.RemoteAddr)
-	}
-	return userIP, nil
+	return remoteIP(req)
 }
 
 // The key type is unexported to prevent collisions with context keys defined in
@@ -37,9 +29,11 @@ type key int
 // different integer values.
 const userIPKey key = 0
 
-// NewContext returns a new Context carrying userIP.
+// NewContext returns a new Context carrying userIP, normalized so that
+// IPv4-mapped IPv6 addresses are stored in their IPv4 form.
+// NewContext 返回一个携带 userIP 的新 Context，映射到 IPv6 的 IPv4 地址会以 IPv4 形式存储。
 func NewContext(ctx context.Context, userIP net.IP) context.Context {
-	return context.WithValue(ctx, userIPKey, userIP)
+	return context.WithValue(ctx, userIPKey, Normalize(userIP))
 }
 
 // FromContext extracts the user IP address from ctx, if present.
@@ -0,0 +1,175 @@
+package goio
+
+import (
+	"context"
+	"fmt"
+)
+
+// !!! Copy、CopyN、CopyBuffer 与 ReadAll 一旦开始就无法被打断。本文件为它们加上了 context：
+// !!! 每读写一块数据之前都检查一次取消信号，这样大文件的传输也能遵守请求的截止时间。
+// !!! WriterTo/ReaderFrom 这两条快速路径仍然会被优先使用：把另一端包装成检查 ctx 的
+// !!! ctxWriter/ctxReader，快速路径在每一块数据之间就都会检查取消信号。
+
+// An InterruptedError reports a copy or read stopped by its context. N is
+// the number of bytes copied (or read) before that; Err is ctx.Err().
+// InterruptedError 报告一次被其 context 停止的拷贝或读取。N 是停止之前已经拷贝（或读取）
+// 的字节数，Err 是 ctx.Err()。
+type InterruptedError struct {
+	Op  string // "copy" or "read"
+	N   int64
+	Err error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("goio: %s interrupted after %d bytes: %v", e.Op, e.N, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error { return e.Err }
+
+// CopyContext is like Copy but stops between chunks once ctx is done,
+// returning an *InterruptedError that wraps ctx.Err().
+// CopyContext 与 Copy 类似，但一旦 ctx 结束，就在两块数据之间停止，并返回一个包装了
+// ctx.Err() 的 *InterruptedError。
+func CopyContext(ctx context.Context, dst Writer, src Reader) (written int64, err error) {
+	written, err = copyBufferContext(ctx, dst, src, nil)
+	return written, interrupted(ctx, "copy", written, err)
+}
+
+// CopyBufferContext is like CopyBuffer but stops between chunks once ctx is done.
+// CopyBufferContext 与 CopyBuffer 类似，但一旦 ctx 结束，就在两块数据之间停止。
+func CopyBufferContext(ctx context.Context, dst Writer, src Reader, buf []byte) (written int64, err error) {
+	if buf != nil && len(buf) == 0 {
+		panic("empty buffer in CopyBufferContext")
+	}
+	written, err = copyBufferContext(ctx, dst, src, buf)
+	return written, interrupted(ctx, "copy", written, err)
+}
+
+// CopyNContext is like CopyN but stops between chunks once ctx is done.
+// On return, written == n if and only if err == nil.
+// CopyNContext 与 CopyN 类似，但一旦 ctx 结束，就在两块数据之间停止。
+// 返回时，当且仅当 err == nil 时 written == n。
+func CopyNContext(ctx context.Context, dst Writer, src Reader, n int64) (written int64, err error) {
+	written, err = CopyContext(ctx, dst, LimitReader(src, n))
+	if written == n {
+		return n, nil
+	}
+	if written < n && err == nil {
+		// src stopped early; must have been EOF.
+		err = EOF
+	}
+	return
+}
+
+// ReadAllContext is like ReadAll but stops between reads once ctx is done,
+// returning the data read so far and an *InterruptedError.
+// ReadAllContext 与 ReadAll 类似，但一旦 ctx 结束，就在两次读取之间停止，
+// 并返回到目前为止读取的数据以及一个 *InterruptedError。
+func ReadAllContext(ctx context.Context, r Reader) ([]byte, error) {
+	b := make([]byte, 0, 512)
+	for {
+		if err := ctx.Err(); err != nil {
+			return b, &InterruptedError{Op: "read", N: int64(len(b)), Err: err}
+		}
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err != nil {
+			if err == EOF {
+				err = nil
+			}
+			return b, err
+		}
+	}
+}
+
+// copyBufferContext is copyBuffer with a check of ctx before every chunk.
+// copyBufferContext 就是在每块数据之前都检查一次 ctx 的 copyBuffer。
+func copyBufferContext(ctx context.Context, dst Writer, src Reader, buf []byte) (written int64, err error) {
+	// The fast paths copy in chunks of their own choosing; the wrapped side
+	// checks ctx before each of them.
+	//快速路径按它们自己选择的块来拷贝，被包装的一端在每一块之前检查 ctx。
+	if wt, ok := src.(WriterTo); ok {
+		return wt.WriteTo(&ctxWriter{ctx, dst})
+	}
+	if rt, ok := dst.(ReaderFrom); ok {
+		return rt.ReadFrom(&ctxReader{ctx, src})
+	}
+	if buf == nil {
+		size := 32 * 1024
+		if l, ok := src.(*LimitedReader); ok && int64(size) > l.N {
+			if l.N < 1 {
+				size = 1
+			} else {
+				size = int(l.N)
+			}
+		}
+		buf = make([]byte, size)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			nw, ew := dst.Write(buf[0:nr])
+			if nw < 0 || nr < nw {
+				nw = 0
+				if ew == nil {
+					ew = errInvalidWrite
+				}
+			}
+			written += int64(nw)
+			if ew != nil {
+				return written, ew
+			}
+			if nr != nw {
+				return written, ErrShortWrite
+			}
+		}
+		if er != nil {
+			if er != EOF {
+				return written, er
+			}
+			return written, nil
+		}
+	}
+}
+
+// interrupted turns the error of a copy stopped by ctx into an *InterruptedError.
+func interrupted(ctx context.Context, op string, n int64, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return &InterruptedError{Op: op, N: n, Err: ctx.Err()}
+	}
+	return err
+}
+
+// ctxReader is a Reader that fails with ctx.Err() once ctx is done.
+// ctxReader 是一个在 ctx 结束后就以 ctx.Err() 失败的 Reader。
+type ctxReader struct {
+	ctx context.Context
+	r   Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// ctxWriter is a Writer that fails with ctx.Err() once ctx is done.
+// ctxWriter 是一个在 ctx 结束后就以 ctx.Err() 失败的 Writer。
+type ctxWriter struct {
+	ctx context.Context
+	w   Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
@@ -0,0 +1,150 @@
+package goio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// stringSource 读出 s，结束时返回本包的 EOF（而不是 io.EOF）。
+type stringSource struct{ r *strings.Reader }
+
+func newStringSource(s string) Reader { return stringSource{strings.NewReader(s)} }
+
+func (s stringSource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err == io.EOF {
+		err = EOF
+	}
+	return n, err
+}
+
+// chunkReader 无限地返回 chunk 字节大小的数据块，在读出第 stopAfter 块之后调用 stop。
+type chunkReader struct {
+	chunk, reads, stopAfter int
+	stop                    func()
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads == r.stopAfter {
+		r.stop()
+	}
+	return copy(p, bytes.Repeat([]byte("x"), min(r.chunk, len(p)))), nil
+}
+
+// writerToSource 只通过 WriterTo 快速路径交出数据，写出的块与 chunkReader 相同。
+type writerToSource struct{ chunkReader }
+
+func (s *writerToSource) WriteTo(w Writer) (n int64, err error) {
+	buf := make([]byte, s.chunk)
+	for {
+		nr, _ := s.chunkReader.Read(buf)
+		nw, err := w.Write(buf[:nr])
+		n += int64(nw)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func checkInterrupted(t *testing.T, err error, op string, n int64) {
+	t.Helper()
+	var ie *InterruptedError
+	if !errors.As(err, &ie) || ie.Op != op || ie.N != n || !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %s interrupted after %d bytes by context.Canceled", err, op, n)
+	}
+}
+
+func TestCopyContextStopsBetweenChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  func(*bytes.Buffer) Writer
+		src  func(stop func()) Reader
+		want int64
+	}{
+		//缓冲区与 ReaderFrom 路径在读之前检查：第三块在取消之前就已读出，仍被写出。
+		//WriterTo 路径在写之前检查：第三块在取消之后才交给 Write，不再写出。
+		{"buffer",
+			func(b *bytes.Buffer) Writer { return b },
+			func(stop func()) Reader { return &chunkReader{chunk: 100, stopAfter: 3, stop: stop} },
+			300},
+		{"WriterTo",
+			func(b *bytes.Buffer) Writer { return b },
+			func(stop func()) Reader {
+				return &writerToSource{chunkReader{chunk: 100, stopAfter: 3, stop: stop}}
+			},
+			200},
+		{"ReaderFrom",
+			func(*bytes.Buffer) Writer { return Discard },
+			func(stop func()) Reader { return &chunkReader{chunk: 100, stopAfter: 3, stop: stop} },
+			300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var buf bytes.Buffer
+			n, err := CopyContext(ctx, tt.dst(&buf), tt.src(cancel))
+			if n != tt.want {
+				t.Errorf("written = %d, want %d", n, tt.want)
+			}
+			checkInterrupted(t, err, "copy", n)
+		})
+	}
+}
+
+func TestCopyContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	n, err := CopyContext(ctx, &buf, newStringSource("hello"))
+	if n != 0 || buf.Len() != 0 {
+		t.Errorf("copied %d bytes with a done context", n)
+	}
+	checkInterrupted(t, err, "copy", 0)
+
+	n, err = CopyContext(context.Background(), &buf, newStringSource("hello"))
+	if n != 5 || err != nil || buf.String() != "hello" {
+		t.Errorf("CopyContext = %d, %v; copied %q", n, err, buf.String())
+	}
+}
+
+func TestCopyNContext(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	n, err := CopyNContext(ctx, &buf, newStringSource("hello, world"), 5)
+	if n != 5 || err != nil || buf.String() != "hello" {
+		t.Errorf("CopyNContext = %d, %v; copied %q", n, err, buf.String())
+	}
+	n, err = CopyNContext(ctx, Discard, newStringSource("hello"), 10)
+	if n != 5 || err != EOF {
+		t.Errorf("CopyNContext from a short source = %d, %v; want 5, EOF", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	n, err = CopyNContext(ctx, Discard, &chunkReader{chunk: 10, stopAfter: 2, stop: cancel}, 1000)
+	if n != 20 {
+		t.Errorf("written = %d, want 20", n)
+	}
+	checkInterrupted(t, err, "copy", n)
+}
+
+func TestReadAllContext(t *testing.T) {
+	b, err := ReadAllContext(context.Background(), newStringSource("hello"))
+	if string(b) != "hello" || err != nil {
+		t.Errorf("ReadAllContext = %q, %v", b, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b, err = ReadAllContext(ctx, &chunkReader{chunk: 100, stopAfter: 4, stop: cancel})
+	if len(b) != 400 {
+		t.Errorf("read %d bytes, want 400", len(b))
+	}
+	checkInterrupted(t, err, "read", 400)
+}
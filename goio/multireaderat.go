@@ -0,0 +1,117 @@
+package goio
+
+import (
+	"io"
+	"sort"
+)
+
+// !!! io.MultiReader 把多个读取器首尾相连，但只能向前读。MultiReaderAt 把多个知道自身大小的
+// !!! ReaderAt 拼接成一个逻辑上的“虚拟文件”，它可以被随机读取（ReadAt）、顺序读取（Read）和
+// !!! 跳跃（Seek），偏移量会被正确地映射到各个分段，一次读取也可以跨越分段的边界。
+// !!! StringReader 与 SectionReader 都实现了 SizedReaderAt；文件可以用
+// !!! NewSectionReader(f, 0, size) 包装之后再拼接。
+
+// SizedReaderAt is a ReaderAt that knows its size.
+// SizedReaderAt 是知道自身大小的 ReaderAt。
+type SizedReaderAt interface {
+	ReaderAt
+	Size() int64
+}
+
+// NewMultiReaderAt returns a MultiReaderAt that is the logical concatenation
+// of parts. The sizes of the parts are read once, here.
+// NewMultiReaderAt 返回一个 MultiReaderAt，它是 parts 在逻辑上的串联。各个分段的大小
+// 只在这里读取一次。
+func NewMultiReaderAt(parts ...SizedReaderAt) *MultiReaderAt {
+	m := &MultiReaderAt{
+		parts: append([]SizedReaderAt(nil), parts...),
+		ends:  make([]int64, len(parts)),
+	}
+	for i, p := range parts {
+		m.size += p.Size()
+		m.ends[i] = m.size
+	}
+	return m
+}
+
+// MultiReaderAt implements Read, Seek, ReadAt and Size on the concatenation
+// of several SizedReaderAts. ReadAt may be called concurrently if the parts
+// allow it; Read and Seek may not.
+// MultiReaderAt 在多个 SizedReaderAt 的串联上实现了 Read、Seek、ReadAt 与 Size 方法。
+// 如果各个分段允许，ReadAt 可以被并发调用；Read 与 Seek 不可以。
+type MultiReaderAt struct {
+	parts []SizedReaderAt
+	ends  []int64 //ends[i] 是第 i 个分段的结尾在逻辑流中的偏移量，单调不减。
+	size  int64   //所有分段的总大小
+	off   int64   //下一次 Read 的开始位置
+}
+
+// Size returns the total size of the parts in bytes.
+// Size 方法返回所有分段的总字节数。
+func (m *MultiReaderAt) Size() int64 { return m.size }
+
+// 是对ReaderAt的实现。
+// !!! 先用二分查找找到 off 所在的分段，再依次从各个分段读取，直到填满 p 或者到达结尾。
+func (m *MultiReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errOffset
+	}
+	if off >= m.size {
+		return 0, EOF
+	}
+	//第一个结尾在 off 之后的分段，大小为 0 的分段被自然地跳过。
+	i := sort.Search(len(m.ends), func(i int) bool { return m.ends[i] > off })
+	for ; i < len(m.parts) && n < len(p); i++ {
+		start := m.ends[i] - m.parts[i].Size()
+		want := min(int64(len(p)-n), m.ends[i]-off)
+		if want <= 0 {
+			continue
+		}
+		got, err := m.parts[i].ReadAt(p[n:n+int(want)], off-start)
+		n += got
+		off += int64(got)
+		if int64(got) < want {
+			//!!! 分段比它声明的大小要短，或者底层读取出错。
+			if err == nil || err == EOF || err == io.EOF {
+				err = ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		//读满了 want 个字节，分段在结尾处返回的 EOF 不是错误。
+	}
+	if n < len(p) {
+		return n, EOF
+	}
+	return n, nil
+}
+
+// 是对Reader的实现，从当前位置开始读取并向后移动。
+func (m *MultiReaderAt) Read(p []byte) (n int, err error) {
+	if m.off >= m.size {
+		return 0, EOF
+	}
+	n, err = m.ReadAt(p, m.off)
+	m.off += int64(n)
+	if err == EOF && n > 0 {
+		err = nil //!!! 读到了数据就先不报告EOF，下一次Read再返回EOF。
+	}
+	return
+}
+
+// 是对Seeker接口的实现，与 SectionReader 的 Seek 相同。
+func (m *MultiReaderAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	default:
+		return 0, errWhence
+	case SeekStart:
+	case SeekCurrent:
+		offset += m.off
+	case SeekEnd:
+		offset += m.size
+	}
+	if offset < 0 {
+		return 0, errOffset
+	}
+	m.off = offset
+	return offset, nil
+}
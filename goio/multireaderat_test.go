@@ -0,0 +1,131 @@
+package goio
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newVirtualFile 把 StringReader、SectionReader、一个空分段和一个文件拼接成一个虚拟文件，
+// 同时返回它应有的内容。
+func newVirtualFile(t *testing.T) (*MultiReaderAt, string) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "part")
+	if err := os.WriteFile(name, []byte("file-part"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	m := NewMultiReaderAt(
+		NewReader("hello, "),
+		NewSectionReader(strings.NewReader("[section]"), 1, 7),
+		NewReader(""),
+		NewSectionReader(f, 0, 9),
+	)
+	return m, "hello, section" + "file-part"
+}
+
+func TestMultiReaderAtReadAt(t *testing.T) {
+	m, want := newVirtualFile(t)
+	if m.Size() != int64(len(want)) {
+		t.Fatalf("Size = %d, want %d", m.Size(), len(want))
+	}
+	//所有的偏移量与长度组合，覆盖每一个分段边界。
+	for off := 0; off < len(want); off++ {
+		for length := 0; length <= len(want)-off+2; length++ {
+			p := make([]byte, length)
+			n, err := m.ReadAt(p, int64(off))
+			wantN := min(length, len(want)-off)
+			if n != wantN || string(p[:n]) != want[off:off+wantN] {
+				t.Fatalf("ReadAt(%d bytes, %d) = %q", length, off, p[:n])
+			}
+			if (n < length) != (err == EOF) || n == length && err != nil {
+				t.Fatalf("ReadAt(%d bytes, %d) = %d, %v", length, off, n, err)
+			}
+		}
+	}
+	if n, err := m.ReadAt(make([]byte, 1), m.Size()); n != 0 || err != EOF {
+		t.Errorf("ReadAt at the end = %d, %v; want 0, EOF", n, err)
+	}
+	if _, err := m.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("ReadAt at a negative offset succeeded")
+	}
+}
+
+func TestMultiReaderAtReadAndSeek(t *testing.T) {
+	m, want := newVirtualFile(t)
+	var got []byte
+	p := make([]byte, 4)
+	for {
+		n, err := m.Read(p)
+		got = append(got, p[:n]...)
+		if err == EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(got) != want {
+		t.Fatalf("Read got %q, want %q", got, want)
+	}
+
+	if pos, err := m.Seek(-11, SeekEnd); pos != 12 || err != nil {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	n, _ := m.Read(p)
+	if string(p[:n]) != "onfi" {
+		t.Errorf("Read after Seek = %q", p[:n])
+	}
+	if pos, _ := m.Seek(-2, SeekCurrent); pos != 14 {
+		t.Errorf("Seek(-2, SeekCurrent) = %d", pos)
+	}
+	if _, err := m.Seek(-1, SeekStart); err == nil {
+		t.Error("Seek before the start succeeded")
+	}
+}
+
+func TestMultiReaderAtShortPart(t *testing.T) {
+	//分段声明的大小超过了它实际的数据。
+	m := NewMultiReaderAt(NewReader("ab"), NewSectionReader(strings.NewReader("cd"), 0, 5), NewReader("ef"))
+	p := make([]byte, 9)
+	n, err := m.ReadAt(p, 0)
+	if n != 4 || err != ErrUnexpectedEOF {
+		t.Errorf("ReadAt = %d, %v; want 4, ErrUnexpectedEOF", n, err)
+	}
+}
+
+// TestMultiReaderAtServeContent 用虚拟文件响应 HTTP 范围请求。
+func TestMultiReaderAtServeContent(t *testing.T) {
+	m, want := newVirtualFile(t)
+	req := httptest.NewRequest("GET", "/virtual", nil)
+	req.Header.Set("Range", "bytes=5-16")
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, "virtual.txt", time.Time{}, struct {
+		io.Reader
+		io.Seeker
+	}{stdReader{m}, m})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != want[5:17] {
+		t.Errorf("status %d, body %q; want 206, %q", rec.Code, rec.Body.String(), want[5:17])
+	}
+}
+
+// stdReader 把本包的 EOF 转换为 io.EOF，供标准库使用。
+type stdReader struct{ r Reader }
+
+func (r stdReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if errors.Is(err, EOF) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,154 @@
+package goio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// !!! Copy 只用一个 goroutine 顺序地读写，拷贝数 GB 的数据文件时磁盘与 CPU 大多处于空闲状态。
+// !!! ParallelCopy 把 [0, size) 切分成若干块，每一块都是一对 SectionReader/SectionWriter，
+// !!! 由固定数量的 worker 并发拷贝。任何一块出错，都会取消其余的 worker，并报告第一个错误。
+
+// ErrChecksumMismatch is reported by ParallelCopy when a chunk read back
+// from dst differs from what was read from src.
+// 当从 dst 读回的某一块与从 src 读出的数据不同时，ParallelCopy 报告 ErrChecksumMismatch。
+var ErrChecksumMismatch = errors.New("goio: checksum mismatch")
+
+// ParallelCopyOptions configures ParallelCopy. The zero value, like a nil
+// pointer, copies 8 MiB chunks with GOMAXPROCS workers and no verification.
+// ParallelCopyOptions 用于配置 ParallelCopy。零值（以及 nil 指针）表示用 GOMAXPROCS 个
+// worker 拷贝 8 MiB 大小的块，并且不做校验。
+type ParallelCopyOptions struct {
+	ChunkSize int64 // bytes per chunk 每一块的字节数
+	Workers   int   // chunks copied at once 同时拷贝的块数
+
+	// Hash, if not nil, makes every chunk be read back from dst, which must
+	// then implement ReaderAt, and compared with the hash of what was read
+	// from src.
+	// Hash 不为 nil 时，每一块都会从 dst（此时 dst 必须实现 ReaderAt）读回，并与从 src
+	// 读出的数据的哈希值进行比较。
+	Hash func() hash.Hash
+}
+
+func (o *ParallelCopyOptions) chunkSize() int64 {
+	if o == nil || o.ChunkSize <= 0 {
+		return 8 << 20
+	}
+	return o.ChunkSize
+}
+
+func (o *ParallelCopyOptions) workers() int {
+	if o == nil || o.Workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Workers
+}
+
+func (o *ParallelCopyOptions) hash() func() hash.Hash {
+	if o == nil {
+		return nil
+	}
+	return o.Hash
+}
+
+// ParallelCopy copies size bytes from src to dst at the same offsets, in
+// chunks copied concurrently. It returns the number of bytes copied and
+// the first error encountered, after which the remaining chunks are not copied.
+// ParallelCopy 把 src 中的 size 个字节拷贝到 dst 的相同偏移处，各个块被并发地拷贝。它返回
+// 拷贝的字节数与遇到的第一个错误，出错之后剩下的块不再拷贝。
+func ParallelCopy(dst WriterAt, src ReaderAt, size int64, opts *ParallelCopyOptions) (written int64, err error) {
+	return ParallelCopyContext(context.Background(), dst, src, size, opts)
+}
+
+// ParallelCopyContext is like ParallelCopy but stops every worker once ctx
+// is done, returning an *InterruptedError that wraps ctx.Err().
+// ParallelCopyContext 与 ParallelCopy 类似，但一旦 ctx 结束就停止所有的 worker，并返回
+// 一个包装了 ctx.Err() 的 *InterruptedError。
+func ParallelCopyContext(ctx context.Context, dst WriterAt, src ReaderAt, size int64, opts *ParallelCopyOptions) (written int64, err error) {
+	newHash := opts.hash()
+	var check ReaderAt
+	if newHash != nil {
+		var ok bool
+		if check, ok = dst.(ReaderAt); !ok {
+			return 0, errors.New("goio: ParallelCopy verification needs a dst that implements ReaderAt")
+		}
+	}
+	chunk := opts.chunkSize()
+
+	//!!! 第一个出错的 worker 以它的错误作为原因取消 copyCtx，其余的 worker 随之停止。
+	copyCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	offsets := make(chan int64)
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for range min(int64(opts.workers()), (size+chunk-1)/chunk) {
+		wg.Go(func() {
+			buf := make([]byte, min(chunk, 32*1024)) //每个 worker 复用自己的缓存
+			for off := range offsets {
+				n := min(chunk, size-off)
+				c, err := copyChunk(copyCtx, dst, src, off, n, buf, newHash, check)
+				total.Add(c)
+				if err != nil {
+					cancel(fmt.Errorf("goio: chunk at offset %d: %w", off, err))
+					return
+				}
+			}
+		})
+	}
+feed:
+	for off := int64(0); off < size; off += chunk {
+		select {
+		case offsets <- off:
+		case <-copyCtx.Done():
+			break feed
+		}
+	}
+	close(offsets)
+	wg.Wait()
+
+	written = total.Load()
+	if ctx.Err() != nil {
+		return written, &InterruptedError{Op: "copy", N: written, Err: ctx.Err()}
+	}
+	if copyCtx.Err() != nil {
+		return written, context.Cause(copyCtx)
+	}
+	return written, nil
+}
+
+// copyChunk copies the n bytes at off from src to dst and, if newHash is
+// not nil, verifies them by reading them back from check.
+// copyChunk 把 src 中 off 处的 n 个字节拷贝到 dst；如果 newHash 不为 nil，就从 check 读回
+// 这些字节进行校验。
+func copyChunk(ctx context.Context, dst WriterAt, src ReaderAt, off, n int64, buf []byte, newHash func() hash.Hash, check ReaderAt) (written int64, err error) {
+	var r Reader = NewSectionReader(src, off, n)
+	var h hash.Hash
+	if newHash != nil {
+		h = newHash()
+		r = TeeReader(r, h)
+	}
+	written, err = CopyBufferContext(ctx, NewSectionWriter(dst, off, n), r, buf)
+	//!!! src 比 size 短时，底层的 ReadAt 可能返回标准库的 io.EOF，也可能什么都不返回。
+	if err == io.EOF || err == nil && written < n {
+		err = ErrUnexpectedEOF
+	}
+	if err != nil || h == nil {
+		return written, err
+	}
+
+	sum := h.Sum(nil)
+	h.Reset()
+	if c, err := CopyBufferContext(ctx, h, NewSectionReader(check, off, n), buf); err != nil && err != io.EOF {
+		return written, err
+	} else if c != n || !bytes.Equal(h.Sum(nil), sum) {
+		return written, ErrChecksumMismatch
+	}
+	return written, nil
+}
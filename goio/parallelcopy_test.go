@@ -0,0 +1,131 @@
+package goio
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// readWriterAt 在 bufferAt 的基础上实现 ReaderAt，corrupt 不为负数时写入该偏移处的字节会被篡改。
+type readWriterAt struct {
+	bufferAt
+	corrupt int64
+}
+
+func (w *readWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.bufferAt.WriteAt(p, off)
+	if w.corrupt >= off && w.corrupt < off+int64(n) {
+		w.mu.Lock()
+		w.b[w.corrupt] ^= 0xff
+		w.mu.Unlock()
+	}
+	return n, err
+}
+
+func (w *readWriterAt) ReadAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if off >= int64(len(w.b)) {
+		return 0, EOF
+	}
+	n := copy(p, w.b[off:])
+	if n < len(p) {
+		return n, EOF
+	}
+	return n, nil
+}
+
+// hookReaderAt 在每次 ReadAt 之前调用 hook，hook 返回的错误会作为 ReadAt 的错误。
+type hookReaderAt struct {
+	r     ReaderAt
+	reads atomic.Int64
+	hook  func(off int64) error
+}
+
+func (r *hookReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.reads.Add(1)
+	if err := r.hook(off); err != nil {
+		return 0, err
+	}
+	return r.r.ReadAt(p, off)
+}
+
+func TestParallelCopy(t *testing.T) {
+	data := strings.Repeat("0123456789", 10007)
+	for _, opts := range []*ParallelCopyOptions{
+		nil,
+		{ChunkSize: 1000, Workers: 4},
+		{ChunkSize: 999, Workers: 3, Hash: sha256.New},
+	} {
+		dst := &readWriterAt{corrupt: -1}
+		n, err := ParallelCopy(dst, strings.NewReader(data), int64(len(data)), opts)
+		if n != int64(len(data)) || err != nil {
+			t.Fatalf("ParallelCopy(%+v) = %d, %v", opts, n, err)
+		}
+		if string(dst.b) != data {
+			t.Errorf("ParallelCopy(%+v) copied different data", opts)
+		}
+	}
+}
+
+func TestParallelCopyFirstErrorStopsWorkers(t *testing.T) {
+	data := strings.Repeat("x", 100000)
+	errBoom := errors.New("boom")
+	src := &hookReaderAt{r: strings.NewReader(data), hook: func(off int64) error {
+		if off == 5000 {
+			return errBoom
+		}
+		return nil
+	}}
+	n, err := ParallelCopy(&bufferAt{}, src, int64(len(data)), &ParallelCopyOptions{ChunkSize: 100, Workers: 4})
+	if !errors.Is(err, errBoom) || !strings.Contains(err.Error(), "offset 5000") {
+		t.Fatalf("err = %v, want boom at offset 5000", err)
+	}
+	//出错之后剩下的块不再拷贝：1000 块中只有出错之前的那些（再加上正在拷贝的几块）被读取。
+	if reads := src.reads.Load(); reads > 100 || n >= int64(len(data)) {
+		t.Errorf("copied %d bytes in %d reads after the error", n, reads)
+	}
+}
+
+func TestParallelCopyContextCanceled(t *testing.T) {
+	data := strings.Repeat("x", 100000)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := &hookReaderAt{r: strings.NewReader(data), hook: func(off int64) error {
+		if off == 3000 {
+			cancel()
+		}
+		return nil
+	}}
+	n, err := ParallelCopyContext(ctx, &bufferAt{}, src, int64(len(data)), &ParallelCopyOptions{ChunkSize: 100, Workers: 2})
+	var ie *InterruptedError
+	if !errors.As(err, &ie) || !errors.Is(err, context.Canceled) || ie.N != n {
+		t.Fatalf("err = %v, want an InterruptedError after %d bytes", err, n)
+	}
+	if reads := src.reads.Load(); reads > 100 {
+		t.Errorf("%d reads after cancel", reads)
+	}
+}
+
+func TestParallelCopyVerify(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+	opts := &ParallelCopyOptions{ChunkSize: 1000, Workers: 2, Hash: sha256.New}
+	_, err := ParallelCopy(&readWriterAt{corrupt: 4321}, strings.NewReader(data), int64(len(data)), opts)
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "offset 4000") {
+		t.Errorf("corrupted chunk: %v", err)
+	}
+	if _, err := ParallelCopy(&bufferAt{}, strings.NewReader(data), int64(len(data)), opts); err == nil {
+		t.Error("verification with a dst that cannot be read back succeeded")
+	}
+}
+
+func TestParallelCopyShortSource(t *testing.T) {
+	//只用一个 worker，块按顺序拷贝：第一块完整，第二块只读到 1 个字节。
+	n, err := ParallelCopy(&bufferAt{}, strings.NewReader("short"), 10, &ParallelCopyOptions{ChunkSize: 4, Workers: 1})
+	if !errors.Is(err, ErrUnexpectedEOF) || n != 5 {
+		t.Errorf("ParallelCopy from a short source = %d, %v; want 5, ErrUnexpectedEOF", n, err)
+	}
+}
@@ -0,0 +1,237 @@
+package goio
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// !!! ProgressReader 与 ProgressWriter 统计流经它们的字节数，并按设定的字节间隔或时间间隔
+// !!! 回调用户函数，报告已传输的字节数、速度与预计剩余时间（ETA），CLI 就可以据此画出进度条。
+// !!! 计数由一个 ProgressMeter 完成，多个读取器/写入器可以共享同一个 ProgressMeter，
+// !!! 例如 TeeReader 的读取端与 MultiWriter 的某一路写入端。
+
+// Progress is a snapshot of a transfer.
+// Progress 是一次传输的快照。
+type Progress struct {
+	Bytes   int64         // bytes transferred so far 到目前为止传输的字节数
+	Total   int64         // bytes to transfer, or -1 if unknown 需要传输的字节数，未知时为 -1
+	Elapsed time.Duration // since the meter was created 从创建计量器开始经过的时间
+	Rate    float64       // average bytes per second 平均每秒字节数
+	ETA     time.Duration // time left, or -1 if unknown 剩余时间，未知时为 -1
+	Done    bool          // the transfer has finished 传输已经结束
+}
+
+// A ProgressMeter counts bytes and calls Func with the Progress after every
+// EveryBytes bytes or Every duration, whichever comes first; when both are
+// zero it calls Func for every Read or Write. Func is called once more with
+// Done set when the transfer finishes. Calls to Func are serialized, and Func
+// must not call back into the meter. It is safe for concurrent use.
+//
+// A ProgressMeter may also be built as a struct literal, with Total set to
+// -1 if it is unknown; such a meter starts at its first Add or Progress.
+// ProgressMeter 统计字节数，每经过 EveryBytes 个字节或者 Every 时长（以先到者为准）就
+// 以当前的 Progress 调用 Func；两者都为零时，每次 Read 或 Write 都会调用 Func。传输结束时，
+// 还会以设置了 Done 的 Progress 再调用一次 Func。对 Func 的调用是串行的，Func 不能再调用
+// 该计量器。ProgressMeter 可以被并发使用。
+//
+// ProgressMeter 也可以用结构体字面量构造，总量未知时要把 Total 设置为 -1；
+// 这样的计量器从第一次 Add 或 Progress 开始计时。
+type ProgressMeter struct {
+	Total      int64
+	EveryBytes int64
+	Every      time.Duration
+	Func       func(Progress)
+
+	mu       sync.Mutex
+	start    time.Time
+	n        int64
+	reportN  int64     // n at the last report 上一次报告时的 n
+	reportAt time.Time // time of the last report 上一次报告的时间
+	done     bool
+	now      func() time.Time // nil means time.Now; replaced by tests，nil 表示 time.Now，测试中会替换它
+}
+
+// NewProgressMeter returns a meter of a transfer of total bytes (-1 if
+// unknown) that reports to fn, starting now.
+// NewProgressMeter 返回一个从现在开始计量 total 个字节（未知时为 -1）的传输、并向 fn 报告的计量器。
+func NewProgressMeter(total int64, fn func(Progress)) *ProgressMeter {
+	m := &ProgressMeter{Total: total, Func: fn}
+	m.clock()
+	return m
+}
+
+// clock returns the current time, starting the meter on first use; m.mu
+// must be held unless m is not shared yet.
+// clock 返回当前时间，第一次使用时开始计时；除非 m 还没有被共享，否则调用时必须持有 m.mu。
+func (m *ProgressMeter) clock() time.Time {
+	if m.now == nil {
+		m.now = time.Now
+	}
+	now := m.now()
+	if m.start.IsZero() {
+		m.start, m.reportAt = now, now
+	}
+	return now
+}
+
+// Progress returns the current Progress of m.
+// Progress 返回 m 当前的 Progress。
+func (m *ProgressMeter) Progress() Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.progress(m.clock())
+}
+
+// Add counts n more bytes and reports if an interval has passed. Reaching
+// a known Total finishes the transfer.
+// Add 再计入 n 个字节，如果已经过了一个间隔就报告一次。到达已知的 Total 时传输结束。
+func (m *ProgressMeter) Add(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return
+	}
+	m.n += n
+	now := m.clock()
+	if m.Total >= 0 && m.n >= m.Total {
+		m.finish(now)
+		return
+	}
+	due := m.EveryBytes == 0 && m.Every == 0 ||
+		m.EveryBytes > 0 && m.n-m.reportN >= m.EveryBytes ||
+		m.Every > 0 && now.Sub(m.reportAt) >= m.Every
+	if due && n > 0 {
+		m.report(now)
+	}
+}
+
+// Finish reports the final Progress, with Done set. Only the first call reports.
+// Finish 报告最终的 Progress（设置了 Done）。只有第一次调用会报告。
+func (m *ProgressMeter) Finish() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.done {
+		m.finish(m.clock())
+	}
+}
+
+func (m *ProgressMeter) finish(now time.Time) {
+	m.done = true
+	m.report(now)
+}
+
+func (m *ProgressMeter) report(now time.Time) {
+	m.reportN, m.reportAt = m.n, now
+	if m.Func != nil {
+		m.Func(m.progress(now))
+	}
+}
+
+func (m *ProgressMeter) progress(now time.Time) Progress {
+	p := Progress{Bytes: m.n, Total: m.Total, Elapsed: now.Sub(m.start), ETA: -1, Done: m.done}
+	if p.Elapsed > 0 {
+		p.Rate = float64(p.Bytes) / p.Elapsed.Seconds()
+	}
+	switch {
+	case p.Done:
+		p.ETA = 0
+	case p.Total >= 0 && p.Rate > 0:
+		p.ETA = time.Duration(float64(max(p.Total-p.Bytes, 0)) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// sizer is implemented by readers that know their size, such as
+// SectionReader and StringReader.
+// sizer 由知道自己大小的读取器实现，例如 SectionReader 与 StringReader。
+type sizer interface {
+	Size() int64
+}
+
+// NewProgressReader returns a ProgressReader of r reporting to fn. The
+// total is r.Size() when r has such a method, as SectionReader and
+// StringReader do, and unknown otherwise.
+// NewProgressReader 返回一个读取 r 并向 fn 报告的 ProgressReader。如果 r 有 Size 方法
+// （SectionReader 与 StringReader 都有），总量就是 r.Size()，否则总量未知。
+func NewProgressReader(r Reader, fn func(Progress)) *ProgressReader {
+	total := int64(-1)
+	if s, ok := r.(sizer); ok {
+		total = s.Size()
+	}
+	return &ProgressReader{r, NewProgressMeter(total, fn)}
+}
+
+// A ProgressReader counts the bytes read from R with M. The transfer
+// finishes at end of input.
+// ProgressReader 用 M 统计从 R 读取的字节数。读到输入的结尾时传输结束。
+type ProgressReader struct {
+	R Reader         // underlying reader 底层的读取器
+	M *ProgressMeter // meter of the transfer 传输的计量器
+}
+
+func (p *ProgressReader) Read(b []byte) (n int, err error) {
+	n, err = p.R.Read(b)
+	p.M.Add(int64(n))
+	//!!! 本包的 EOF 与标准库的 io.EOF 是两个不同的值，StringReader 等返回的是 io.EOF。
+	if err == EOF || err == io.EOF {
+		p.M.Finish()
+	}
+	return
+}
+
+// WriteTo lets Copy keep the WriterTo fast path of R, counting what R
+// writes to w.
+// WriteTo 使 Copy 保留 R 的 WriterTo 快速路径，统计 R 写入 w 的字节数。
+func (p *ProgressReader) WriteTo(w Writer) (n int64, err error) {
+	if wt, ok := p.R.(WriterTo); ok {
+		n, err = wt.WriteTo(&ProgressWriter{w, p.M})
+		if err == nil {
+			p.M.Finish()
+		}
+		return n, err
+	}
+	//!!! 用只有 Read 方法的匿名结构体隐藏 WriteTo，避免 copyBuffer 又回到这里。
+	return copyBuffer(w, struct{ Reader }{p}, nil)
+}
+
+// NewProgressWriter returns a ProgressWriter of w, for a transfer of total
+// bytes (-1 if unknown), reporting to fn.
+// NewProgressWriter 返回一个写入 w 的 ProgressWriter，传输总量为 total 个字节（未知时为 -1），
+// 并向 fn 报告。
+func NewProgressWriter(w Writer, total int64, fn func(Progress)) *ProgressWriter {
+	return &ProgressWriter{w, NewProgressMeter(total, fn)}
+}
+
+// A ProgressWriter counts the bytes written to W with M. The transfer
+// finishes when M.Total is reached, when ReadFrom returns successfully or
+// when M.Finish is called.
+// ProgressWriter 用 M 统计写入 W 的字节数。到达 M.Total、ReadFrom 成功返回或者调用
+// M.Finish 时传输结束。
+type ProgressWriter struct {
+	W Writer         // underlying writer 底层的写入器
+	M *ProgressMeter // meter of the transfer 传输的计量器
+}
+
+func (p *ProgressWriter) Write(b []byte) (n int, err error) {
+	n, err = p.W.Write(b)
+	p.M.Add(int64(n))
+	return
+}
+
+// ReadFrom lets Copy keep the ReaderFrom fast path of W, counting what W
+// reads from r. Reading all of r finishes the transfer.
+// ReadFrom 使 Copy 保留 W 的 ReaderFrom 快速路径，统计 W 从 r 读取的字节数。
+// 读完 r 的全部数据时传输结束。
+func (p *ProgressWriter) ReadFrom(r Reader) (n int64, err error) {
+	if rf, ok := p.W.(ReaderFrom); ok {
+		n, err = rf.ReadFrom(&ProgressReader{r, p.M})
+	} else {
+		//!!! 用只有 Write 方法的匿名结构体隐藏 ReadFrom，避免 copyBuffer 又回到这里。
+		n, err = copyBuffer(struct{ Writer }{p}, r, nil)
+	}
+	if err == nil {
+		p.M.Finish() //!!! ReadFrom 成功返回意味着读到了 r 的结尾。
+	}
+	return n, err
+}
@@ -0,0 +1,132 @@
+package goio
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stepClock 每被读取一次就前进 step，用作 ProgressMeter 的时钟。
+func stepClock(m *ProgressMeter, step time.Duration) {
+	t := m.start
+	m.now = func() time.Time {
+		t = t.Add(step)
+		return t
+	}
+}
+
+func TestProgressReaderTotalFromSize(t *testing.T) {
+	data := strings.Repeat("x", 1000)
+	for name, r := range map[string]Reader{
+		"StringReader":  NewReader(data),
+		"SectionReader": NewSectionReader(strings.NewReader(data+"tail"), 0, 1000),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var reports []Progress
+			pr := NewProgressReader(r, func(p Progress) { reports = append(reports, p) })
+			pr.M.EveryBytes = 300
+			stepClock(pr.M, time.Second)
+			//以 100 字节一块读取，直到结尾：StringReader 以 io.EOF 结束，SectionReader 以本包的 EOF 结束。
+			buf := make([]byte, 100)
+			for {
+				if _, err := pr.Read(buf); err != nil {
+					break
+				}
+			}
+			var got []int64
+			for _, p := range reports {
+				got = append(got, p.Bytes)
+			}
+			if len(got) != 4 || got[0] != 300 || got[1] != 600 || got[2] != 900 || got[3] != 1000 {
+				t.Fatalf("reported bytes %v, want [300 600 900 1000]", got)
+			}
+			//每次读取时钟前进一秒：300 字节用了 3 秒，速度 100 字节/秒，还剩 7 秒。
+			if p := reports[0]; p.Total != 1000 || p.Rate != 100 || p.ETA != 7*time.Second || p.Done {
+				t.Errorf("first report %+v", p)
+			}
+			if p := reports[3]; !p.Done || p.ETA != 0 {
+				t.Errorf("last report %+v", p)
+			}
+		})
+	}
+}
+
+func TestProgressMeterTimeInterval(t *testing.T) {
+	var reports []Progress
+	m := NewProgressMeter(-1, func(p Progress) { reports = append(reports, p) })
+	m.Every = 2 * time.Second
+	stepClock(m, time.Second)
+	for range 5 {
+		m.Add(10)
+	}
+	m.Finish()
+	m.Finish()
+	//每 2 秒报告一次，再加上结束时的一次；总量未知时 ETA 也未知。
+	if len(reports) != 3 || reports[0].Bytes != 20 || reports[1].Bytes != 40 || reports[0].ETA != -1 {
+		t.Fatalf("reports %+v", reports)
+	}
+	if last := reports[2]; !last.Done || last.Bytes != 50 {
+		t.Errorf("last report %+v", last)
+	}
+}
+
+// TestProgressMeterZeroValue：用结构体字面量构造的计量器不经过 NewProgressMeter 也能使用。
+func TestProgressMeterZeroValue(t *testing.T) {
+	var reports []Progress
+	m := &ProgressMeter{Total: 100, EveryBytes: 50, Func: func(p Progress) { reports = append(reports, p) }}
+	if p := m.Progress(); p.Bytes != 0 || p.Elapsed < 0 || p.Elapsed > time.Minute {
+		t.Fatalf("initial progress %+v", p)
+	}
+	m.Add(60)
+	m.Add(40)
+	if len(reports) != 2 || reports[0].Bytes != 60 || !reports[1].Done || reports[1].Elapsed > time.Minute {
+		t.Errorf("reports %+v", reports)
+	}
+}
+
+func TestProgressWithTeeReaderAndMultiWriter(t *testing.T) {
+	data := strings.Repeat("varint", 100)
+	var readDone, writeDone Progress
+	pr := NewProgressReader(newStringSource(data), func(p Progress) { readDone = p })
+	var copied, teed bytes.Buffer
+	pw := NewProgressWriter(&teed, int64(len(data)), func(p Progress) { writeDone = p })
+	//TeeReader 把读出的数据同时写入 MultiWriter，其中一路是带进度的写入器。
+	r := TeeReader(pr, io.MultiWriter(io.Discard, pw))
+	if n, err := Copy(&copied, r); n != int64(len(data)) || err != nil {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	if copied.String() != data || teed.String() != data {
+		t.Error("data corrupted")
+	}
+	//newStringSource 没有 Size 方法，读取端的总量未知，在 EOF 时结束；写入端在到达总量时结束。
+	if !readDone.Done || readDone.Total != -1 || readDone.Bytes != int64(len(data)) {
+		t.Errorf("reader progress %+v", readDone)
+	}
+	if !writeDone.Done || writeDone.Bytes != int64(len(data)) {
+		t.Errorf("writer progress %+v", writeDone)
+	}
+}
+
+func TestProgressPassesFastPathsThrough(t *testing.T) {
+	src := &writerToString{s: "hello"}
+	var done Progress
+	pr := NewProgressReader(src, func(p Progress) { done = p })
+	var buf bytes.Buffer
+	if n, err := Copy(&buf, pr); n != 5 || err != nil {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	if !src.wrote || !done.Done || done.Bytes != 5 {
+		t.Errorf("WriterTo used: %v, progress %+v", src.wrote, done)
+	}
+
+	var dst readerFromBuffer
+	pw := NewProgressWriter(&dst, -1, func(p Progress) { done = p })
+	if n, err := Copy(pw, newStringSource("hello, world")); n != 12 || err != nil {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	if !dst.read || !done.Done || done.Bytes != 12 {
+		t.Errorf("ReaderFrom used: %v, progress %+v", dst.read, done)
+	}
+}
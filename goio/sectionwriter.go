@@ -0,0 +1,133 @@
+package goio
+
+import "errors"
+
+// !!! SectionWriter 是 SectionReader 对应的写入器：它基于 WriterAt，在底层流的“特定分段”
+// !!! [off, off+n) 中实现 Write、WriteAt 与 Seek。写入的数据超出分段的结尾时，超出的部分不会
+// !!! 被写入，并返回 ErrSectionFull。
+// !!! 多个 SectionWriter 可以同时写入同一个文件的不同分段，互不干扰（*os.File 的 WriteAt
+// !!! 可以被并发调用），SplitSections 就是用来把一个文件切分成 N 个分段，交给 N 个写入者并行写入的，
+// !!! 例如分块下载之后再组装成一个文件。
+
+// ErrSectionFull is returned by the SectionWriter methods when a write does
+// not fit in the section; the part that fits has been written.
+// 当写入的数据超出分段时，SectionWriter 的方法返回 ErrSectionFull；能够放入分段的部分已经写入。
+var ErrSectionFull = errors.New("goio: write beyond the end of the section")
+
+// NewSectionWriter returns a SectionWriter that writes to w starting at
+// offset off and fails with ErrSectionFull after n bytes.
+// NewSectionWriter 返回一个 SectionWriter，它从偏移量 off 处开始写入 w，写满 n 个字节之后
+// 就以 ErrSectionFull 失败。
+func NewSectionWriter(w WriterAt, off int64, n int64) *SectionWriter {
+	var remaining int64
+	const maxint64 = 1<<63 - 1
+	if off <= maxint64-n {
+		remaining = n + off
+	} else {
+		// Overflow, with no way to return error.
+		//与 NewSectionReader 一样，off+n 溢出时就以最大的整数作为分段的结尾。
+		remaining = maxint64
+	}
+	return &SectionWriter{w, off, off, remaining}
+}
+
+// SectionWriter implements Write, Seek, and WriteAt on a section
+// of an underlying WriterAt.
+// SectionWriter 基于 WriterAt 接口，在底层流的一个分段上实现了 Write、Seek 和 WriteAt 方法。
+type SectionWriter struct {
+	w     WriterAt //具有分段写入能力的字节写入器，作为分段写入器的底层流。
+	base  int64    //分段在底层流 w 中的基址，永远不变。
+	off   int64    //下一次 Write 在底层流 w 中的开始位置，每次写入后增加。
+	limit int64    //分段在底层流 w 中的结尾位置，写入不能越过它。
+}
+
+// 对Writer的实现
+// !!! 分段写入器的Write方法可以多次调用，但是达到所在分段的结尾就会返回ErrSectionFull。
+func (s *SectionWriter) Write(p []byte) (n int, err error) {
+	if s.off >= s.limit {
+		return 0, ErrSectionFull
+	}
+	full := false
+	if max := s.limit - s.off; int64(len(p)) > max {
+		p = p[0:max] //只写入分段中还放得下的部分。
+		full = true
+	}
+	n, err = s.w.WriteAt(p, s.off)
+	s.off += int64(n)
+	if err == nil && full {
+		err = ErrSectionFull
+	}
+	return
+}
+
+// 是对Seeker接口的实现，与 SectionReader 的 Seek 相同。
+// !!! 可以 Seek 到分段结尾之后，但之后的 Write 会返回 ErrSectionFull。
+func (s *SectionWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	default:
+		return 0, errWhence
+	case SeekStart:
+		offset += s.base
+	case SeekCurrent:
+		offset += s.off
+	case SeekEnd:
+		offset += s.limit
+	}
+	if offset < s.base {
+		return 0, errOffset
+	}
+	s.off = offset
+	return offset - s.base, nil
+}
+
+// 是分段写入器对WriterAt的实现。
+// 注意，输入的偏移量代表的是相对于分段写入器起始位置的偏移量。
+func (s *SectionWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errOffset
+	}
+	if off >= s.limit-s.base {
+		return 0, ErrSectionFull
+	}
+	off += s.base //现在的off代表的是相对于底层流的偏移位置。
+	if max := s.limit - off; int64(len(p)) > max {
+		n, err = s.w.WriteAt(p[0:max], off)
+		if err == nil {
+			err = ErrSectionFull
+		}
+		return n, err
+	}
+	return s.w.WriteAt(p, off)
+}
+
+// Size returns the size of the section in bytes.
+// Size方法返回分段的字节数量大小。
+func (s *SectionWriter) Size() int64 { return s.limit - s.base }
+
+// SplitSections splits the first size bytes of w into n adjacent
+// SectionWriters of nearly equal sizes (the first size%n are one byte
+// longer), so that n writers can fill them concurrently. It returns fewer
+// than n sections when size < n, and panics if n < 1.
+// SplitSections 把 w 的前 size 个字节切分成 n 个相邻的、大小几乎相等的 SectionWriter
+// （前 size%n 个分段多一个字节），这样 n 个写入者就可以并发地写入它们。size < n 时返回的
+// 分段少于 n 个；n < 1 时会 panic。
+func SplitSections(w WriterAt, size int64, n int) []*SectionWriter {
+	if n < 1 {
+		panic("goio: SplitSections with n < 1")
+	}
+	if size < int64(n) {
+		n = int(max(size, 1))
+	}
+	sections := make([]*SectionWriter, n)
+	chunk, extra := size/int64(n), size%int64(n)
+	var off int64
+	for i := range sections {
+		length := chunk
+		if int64(i) < extra {
+			length++
+		}
+		sections[i] = NewSectionWriter(w, off, length)
+		off += length
+	}
+	return sections
+}
@@ -0,0 +1,120 @@
+package goio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bufferAt 是一个内存中的 WriterAt，写入超出长度时自动扩展。
+type bufferAt struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+func (w *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(w.b)) {
+		w.b = append(w.b, make([]byte, end-int64(len(w.b)))...)
+	}
+	return copy(w.b[off:], p), nil
+}
+
+func TestSectionWriter(t *testing.T) {
+	w := &bufferAt{b: []byte("..........")}
+	s := NewSectionWriter(w, 2, 5)
+	if n, err := s.Write([]byte("abc")); n != 3 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	//超出分段的部分不会被写入。
+	if n, err := s.Write([]byte("defg")); n != 2 || err != ErrSectionFull {
+		t.Fatalf("Write past the limit = %d, %v; want 2, ErrSectionFull", n, err)
+	}
+	if n, err := s.Write([]byte("h")); n != 0 || err != ErrSectionFull {
+		t.Fatalf("Write at the limit = %d, %v; want 0, ErrSectionFull", n, err)
+	}
+	if got := string(w.b); got != "..abcde..." {
+		t.Fatalf("after Write: %q", got)
+	}
+
+	if pos, err := s.Seek(-4, SeekEnd); pos != 1 || err != nil {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	s.Write([]byte("B"))
+	if n, err := s.WriteAt([]byte("XYZ"), 3); n != 2 || err != ErrSectionFull {
+		t.Fatalf("WriteAt past the limit = %d, %v; want 2, ErrSectionFull", n, err)
+	}
+	if got := string(w.b); got != "..aBcXY..." {
+		t.Fatalf("after WriteAt: %q", got)
+	}
+	if _, err := s.WriteAt([]byte("x"), 5); err != ErrSectionFull {
+		t.Errorf("WriteAt at the limit: %v", err)
+	}
+	if _, err := s.WriteAt([]byte("x"), -1); err != errOffset {
+		t.Errorf("WriteAt before the section: %v", err)
+	}
+	if _, err := s.Seek(-1, SeekStart); err != errOffset {
+		t.Errorf("Seek before the section: %v", err)
+	}
+	if s.Size() != 5 {
+		t.Errorf("Size = %d", s.Size())
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	var sizes []int64
+	for _, s := range SplitSections(&bufferAt{}, 10, 4) {
+		sizes = append(sizes, s.Size())
+	}
+	if len(sizes) != 4 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 2 || sizes[3] != 2 {
+		t.Errorf("sizes of 10 bytes in 4 sections: %v", sizes)
+	}
+	if n := len(SplitSections(&bufferAt{}, 2, 8)); n != 2 {
+		t.Errorf("2 bytes split in %d sections", n)
+	}
+}
+
+// TestSplitSectionsParallel 模拟分块下载：多个 goroutine 并发地写入同一个文件的不同分段。
+func TestSplitSectionsParallel(t *testing.T) {
+	want := []byte(strings.Repeat("0123456789abcdef", 1000))
+	f, err := os.Create(filepath.Join(t.TempDir(), "download"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sections := SplitSections(f, int64(len(want)), 7)
+	var wg sync.WaitGroup
+	var off int64
+	for _, s := range sections {
+		part := want[off : off+s.Size()]
+		off += s.Size()
+		wg.Go(func() {
+			//每个分段按 100 字节一块写入，多写出的一个字节会被拒绝。
+			for len(part) > 0 {
+				n, err := s.Write(part[:min(100, len(part))])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				part = part[n:]
+			}
+			if _, err := s.Write([]byte("!")); err != ErrSectionFull {
+				t.Errorf("extra byte: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("assembled file differs")
+	}
+}
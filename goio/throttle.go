@@ -0,0 +1,199 @@
+package goio
+
+import (
+	"sync"
+	"time"
+)
+
+// !!! ThrottledReader 与 ThrottledWriter 仿照 LimitedReader 的写法：LimitedReader 限制的是
+// !!! “总计读取的字节数”，它们限制的则是“每秒读写的字节数”，可以用来模拟慢速链路。
+// !!! 限速由一个令牌桶（Limiter）完成：桶中最多存放 burst 个令牌（字节），令牌以 bytesPerSec
+// !!! 的速度补充，每读写一个字节就消耗一个令牌，令牌不够时就睡眠到令牌补足为止。
+// !!! 多个流可以共享同一个 Limiter，这时它们加在一起的速度不超过 Limiter 的速度。
+
+// A Limiter is a token bucket that limits the bytes per second of the
+// streams that share it. It is safe for concurrent use, and its rate can be
+// changed at any time.
+// Limiter 是一个令牌桶，限制共享它的所有流每秒的字节数。它可以被并发使用，
+// 它的速度也可以随时修改。
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second; <= 0 means unlimited 每秒的字节数，<=0 表示不限速
+	burst  int
+	tokens float64 // negative when streams are waiting 有流在等待时为负数
+	last   time.Time
+
+	// now and sleep are time.Now and time.Sleep, replaced by tests.
+	//now 与 sleep 就是 time.Now 与 time.Sleep，测试中会替换它们。
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewLimiter returns a Limiter that lets bytesPerSec bytes pass per second
+// in chunks of at most burst bytes, starting with a full bucket. A burst <= 0
+// means one second's worth of bytes; a bytesPerSec <= 0 means unlimited.
+// NewLimiter 返回一个每秒放行 bytesPerSec 个字节的 Limiter，每一块最多 burst 个字节，
+// 开始时桶是满的。burst <= 0 表示一秒钟的字节数；bytesPerSec <= 0 表示不限速。
+func NewLimiter(bytesPerSec int64, burst int) *Limiter {
+	if burst <= 0 {
+		burst = int(max(bytesPerSec, 1))
+	}
+	l := &Limiter{
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: float64(burst),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+	l.last = l.now()
+	return l
+}
+
+// Rate returns the current bytes per second of l.
+// Rate 返回 l 当前每秒的字节数。
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// SetRate changes the bytes per second of l. It applies to every byte
+// passed from now on; streams already sleeping finish their current wait.
+// SetRate 修改 l 每秒的字节数。它对从现在起放行的每个字节生效；已经在睡眠的流
+// 会先完成它们当前的等待。
+func (l *Limiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.now())
+	l.rate = float64(bytesPerSec)
+}
+
+// Burst returns the most bytes l lets pass at once.
+// Burst 返回 l 一次最多放行的字节数。
+func (l *Limiter) Burst() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// WaitN takes n tokens from the bucket, sleeping until the bucket has
+// refilled if it runs short. n should not exceed Burst.
+// WaitN 从桶中取出 n 个令牌，如果令牌不够就睡眠到桶重新补足为止。n 不应超过 Burst。
+func (l *Limiter) WaitN(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	l.advance(l.now())
+	//先记账再睡眠：令牌数变成负数，后来者会排在当前流的后面等待。
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+// chunk returns how many of n bytes may pass in one WaitN.
+func (l *Limiter) chunk(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return n
+	}
+	return min(n, l.burst)
+}
+
+// advance refills the bucket for the time elapsed since the last call.
+// It must be called with l.mu held.
+func (l *Limiter) advance(now time.Time) {
+	if l.rate > 0 {
+		l.tokens = min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// NewThrottledReader returns a ThrottledReader that reads from r at most
+// bytesPerSec bytes per second, in chunks of at most burst bytes.
+// NewThrottledReader 返回一个 ThrottledReader，它从 r 读取，每秒最多 bytesPerSec 个字节，
+// 每一块最多 burst 个字节。
+func NewThrottledReader(r Reader, bytesPerSec int64, burst int) *ThrottledReader {
+	return &ThrottledReader{r, NewLimiter(bytesPerSec, burst)}
+}
+
+// A ThrottledReader reads from R no faster than L allows. Streams that
+// share L share its rate.
+// ThrottledReader 从 R 读取，速度不超过 L 所允许的速度。共享 L 的流共享它的速度。
+type ThrottledReader struct {
+	R Reader   // underlying reader 底层的读取器
+	L *Limiter // limiter of the rate 限制速度的令牌桶
+}
+
+func (t *ThrottledReader) Read(p []byte) (n int, err error) {
+	p = p[:t.L.chunk(len(p))] //!!! 每次最多读取一块，这样令牌桶才能控制节奏。
+	n, err = t.R.Read(p)
+	t.L.WaitN(n) //!!! 按实际读出的字节数消耗令牌。
+	return
+}
+
+// WriteTo lets Copy keep the WriterTo fast path of R: R writes to w through
+// a ThrottledWriter sharing L, so the throttle still holds.
+// WriteTo 使 Copy 保留 R 的 WriterTo 快速路径：R 通过一个共享 L 的 ThrottledWriter
+// 写入 w，因此限速仍然有效。
+func (t *ThrottledReader) WriteTo(w Writer) (n int64, err error) {
+	if wt, ok := t.R.(WriterTo); ok {
+		return wt.WriteTo(&ThrottledWriter{w, t.L})
+	}
+	//!!! 用只有 Read 方法的匿名结构体隐藏 WriteTo，避免 copyBuffer 又回到这里。
+	return copyBuffer(w, struct{ Reader }{t}, nil)
+}
+
+// NewThrottledWriter returns a ThrottledWriter that writes to w at most
+// bytesPerSec bytes per second, in chunks of at most burst bytes.
+// NewThrottledWriter 返回一个 ThrottledWriter，它向 w 写入，每秒最多 bytesPerSec 个字节，
+// 每一块最多 burst 个字节。
+func NewThrottledWriter(w Writer, bytesPerSec int64, burst int) *ThrottledWriter {
+	return &ThrottledWriter{w, NewLimiter(bytesPerSec, burst)}
+}
+
+// A ThrottledWriter writes to W no faster than L allows. Streams that
+// share L share its rate.
+// ThrottledWriter 向 W 写入，速度不超过 L 所允许的速度。共享 L 的流共享它的速度。
+type ThrottledWriter struct {
+	W Writer   // underlying writer 底层的写入器
+	L *Limiter // limiter of the rate 限制速度的令牌桶
+}
+
+func (t *ThrottledWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		//!!! 把大块数据拆成不超过 burst 的小块，每一块写之前先取得令牌。
+		chunk := t.L.chunk(len(p))
+		t.L.WaitN(chunk)
+		nw, err := t.W.Write(p[:chunk])
+		n += nw
+		if err != nil {
+			return n, err
+		}
+		if nw != chunk {
+			return n, ErrShortWrite
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// ReadFrom lets Copy keep the ReaderFrom fast path of W: W reads from r
+// through a ThrottledReader sharing L, so the throttle still holds.
+// ReadFrom 使 Copy 保留 W 的 ReaderFrom 快速路径：W 通过一个共享 L 的 ThrottledReader
+// 从 r 读取，因此限速仍然有效。
+func (t *ThrottledWriter) ReadFrom(r Reader) (n int64, err error) {
+	if rf, ok := t.W.(ReaderFrom); ok {
+		return rf.ReadFrom(&ThrottledReader{r, t.L})
+	}
+	//!!! 用只有 Write 方法的匿名结构体隐藏 ReadFrom，避免 copyBuffer 又回到这里。
+	return copyBuffer(struct{ Writer }{t}, r, nil)
+}
@@ -0,0 +1,135 @@
+package goio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock 替换 Limiter 的时间：睡眠只是把时钟向前拨，并累计睡眠的总时长。
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) limiter(bytesPerSec int64, burst int) *Limiter {
+	l := NewLimiter(bytesPerSec, burst)
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(d time.Duration) {
+		c.now = c.now.Add(d)
+		c.slept += d
+	}
+	l.last = c.now
+	return l
+}
+
+// writerToString 只通过一次 Write 交出 s；wrote 记录快速路径是否被使用。
+type writerToString struct {
+	s     string
+	wrote bool
+}
+
+func (w *writerToString) Read(p []byte) (int, error) { panic("Read bypassed WriteTo") }
+
+func (w *writerToString) WriteTo(dst Writer) (int64, error) {
+	w.wrote = true
+	n, err := dst.Write([]byte(w.s))
+	return int64(n), err
+}
+
+// readerFromBuffer 是一个记录快速路径是否被使用的 ReaderFrom。
+type readerFromBuffer struct {
+	bytes.Buffer
+	read bool
+}
+
+func (b *readerFromBuffer) ReadFrom(r Reader) (int64, error) {
+	b.read = true
+	return copyBuffer(&b.Buffer, r, nil)
+}
+
+func TestThrottledReader(t *testing.T) {
+	var c fakeClock
+	data := strings.Repeat("x", 1000)
+	r := &ThrottledReader{newStringSource(data), c.limiter(100, 100)}
+	var buf bytes.Buffer
+	n, err := Copy(&buf, r)
+	if n != 1000 || err != nil || buf.String() != data {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	//满桶放行第一块 100 字节，剩下的 900 字节以每秒 100 字节的速度通过。
+	if c.slept != 9*time.Second {
+		t.Errorf("slept %v, want 9s", c.slept)
+	}
+}
+
+func TestThrottledWriterSplitsWrites(t *testing.T) {
+	var c fakeClock
+	var buf bytes.Buffer
+	w := &ThrottledWriter{&buf, c.limiter(100, 50)}
+	n, err := w.Write(make([]byte, 250))
+	if n != 250 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	//第一块 50 字节由满桶放行，之后每 50 字节等待半秒。
+	if c.slept != 2*time.Second {
+		t.Errorf("slept %v, want 2s", c.slept)
+	}
+}
+
+func TestThrottlePassesFastPathsThrough(t *testing.T) {
+	var c fakeClock
+	src := &writerToString{s: strings.Repeat("x", 300)}
+	var buf bytes.Buffer
+	if n, err := Copy(&buf, &ThrottledReader{src, c.limiter(100, 100)}); n != 300 || err != nil {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	if !src.wrote || c.slept != 2*time.Second {
+		t.Errorf("WriterTo used: %v, slept %v; want true, 2s", src.wrote, c.slept)
+	}
+
+	c = fakeClock{}
+	var dst readerFromBuffer
+	if n, err := Copy(&ThrottledWriter{&dst, c.limiter(100, 100)}, newStringSource(strings.Repeat("x", 300))); n != 300 || err != nil {
+		t.Fatalf("Copy = %d, %v", n, err)
+	}
+	if !dst.read || c.slept != 2*time.Second {
+		t.Errorf("ReaderFrom used: %v, slept %v; want true, 2s", dst.read, c.slept)
+	}
+}
+
+func TestSharedLimiterAndSetRate(t *testing.T) {
+	var c fakeClock
+	l := c.limiter(100, 100)
+	a := &ThrottledReader{newStringSource(strings.Repeat("a", 200)), l}
+	b := &ThrottledReader{newStringSource(strings.Repeat("b", 200)), l}
+	p := make([]byte, 100)
+	//两个流交替读取，共享每秒 100 字节：400 字节中只有第一块免等待。
+	for range 2 {
+		a.Read(p)
+		b.Read(p)
+	}
+	if c.slept != 3*time.Second {
+		t.Errorf("slept %v, want 3s", c.slept)
+	}
+
+	l.SetRate(200)
+	if l.Rate() != 200 {
+		t.Errorf("Rate = %d, want 200", l.Rate())
+	}
+	c.slept = 0
+	a.R = newStringSource(strings.Repeat("a", 200))
+	a.Read(p)
+	a.Read(p)
+	if c.slept != time.Second {
+		t.Errorf("slept %v after SetRate(200), want 1s", c.slept)
+	}
+
+	l.SetRate(0)
+	c.slept = 0
+	a.R = newStringSource(strings.Repeat("a", 10000))
+	if n, _ := Copy(Discard, a); n != 10000 || c.slept != 0 {
+		t.Errorf("unlimited copy of %d bytes slept %v", n, c.slept)
+	}
+}